@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+
+	"vector-quant-monitor/internal/backfill"
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+)
+
+func runBackfill(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	fs := newFlagSet("backfill", "[flags]")
+	lookback := fs.Int("lookback", 2, "hours of trade history to rebuild")
+	symbols := fs.String("symbols", strings.Join(cfg.Backfill.Symbols, ","),
+		"comma separated symbols, empty discovers them from the income history")
+	schedule := fs.String("schedule", "", `cron spec such as "@hourly", empty runs once`)
+	format := fs.String("format", "log", "output: log (structured logs only) or table (also print positions to stdout)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *lookback < 1 || (*format != "log" && *format != "table") {
+		fs.Usage()
+		return errUsage
+	}
+
+	var table io.Writer
+	if *format == "table" {
+		table = os.Stdout
+	}
+
+	var symbolList []string
+	for _, s := range strings.Split(*symbols, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			symbolList = append(symbolList, s)
+		}
+	}
+
+	store, err := db.Connect(cfg.Database, log)
+	if err != nil {
+		return err
+	}
+	defer store.DB.Close()
+
+	if *schedule == "" {
+		return backfill.RunJob(ctx, cfg, store, *lookback, symbolList, table, log)
+	}
+
+	c := cron.New()
+	_, err = c.AddFunc(*schedule, func() {
+		// RunJob logs its own summary, including the error
+		backfill.RunJob(ctx, cfg, store, *lookback, symbolList, table, log)
+	})
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", *schedule, err)
+	}
+
+	log.Info(fmt.Sprintf("Scheduler started (%s). Waiting for next run...", *schedule))
+	c.Start()
+
+	// Run until shutdown, then let an in-flight job store what it fetched
+	<-ctx.Done()
+	log.Info("Stopping scheduler, waiting for running backfill")
+	<-c.Stop().Done()
+	return nil
+}
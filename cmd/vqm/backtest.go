@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/vector"
+)
+
+func runBacktest(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	opts := vector.BacktestOptions{CheckOptions: vector.DefaultCheckOptions(), Symbol: "ETHUSDT", Interval: "15m"}
+
+	fs := newFlagSet("backtest", "--from 2025-01-01 --to 2025-03-31 [flags]")
+	fs.StringVar(&opts.Symbol, "symbol", opts.Symbol, "symbol of the patterns to predict")
+	fs.StringVar(&opts.Interval, "interval", opts.Interval, "candle interval of the patterns to predict")
+	fs.Var(dateValue{&opts.From}, "from", "first day (UTC) of the patterns to predict")
+	fs.Var(dateValue{&opts.To}, "to", "last day (UTC) of the patterns to predict")
+	predictors := neighborFlags(fs, &opts.CheckOptions)
+	pnl := vector.DefaultPnlOptions(cfg.Binance)
+	simulate := fs.Bool("pnl", false, "also simulate trading the predictions and store the equity curve")
+	fs.Float64Var(&pnl.Leverage, "leverage", pnl.Leverage, "leverage of the simulated positions")
+	maker := fs.Bool("maker", false, "pay the maker fee (BINANCE_MAKER_FEE) instead of the taker fee")
+	fs.Float64Var(&pnl.Slippage, "slippage", pnl.Slippage, "slippage per side as a fraction of the price")
+	fs.IntVar(&pnl.MinNumDiff, "min-num-diff", pnl.MinNumDiff, "trade only when NumDiffCount reaches this")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkNeighborFlags(fs, &opts.CheckOptions, predictors); err != nil {
+		return err
+	}
+	if err := checkIntervals(fs, []string{opts.Interval}); err != nil {
+		return err
+	}
+	if opts.From.IsZero() || opts.To.IsZero() || opts.To.Before(opts.From) {
+		fmt.Fprintln(fs.Output(), "--from and --to are required, --to can't be before --from")
+		fs.Usage()
+		return errUsage
+	}
+	// Include the whole last day
+	opts.To = opts.To.Add(24*time.Hour - time.Second)
+
+	if *simulate {
+		if pnl.Leverage <= 0 || pnl.Slippage < 0 {
+			fs.Usage()
+			return errUsage
+		}
+		if *maker {
+			pnl.FeeRate = cfg.Binance.MakerFee
+		}
+		opts.Pnl = &pnl
+	}
+
+	return vector.StartWalkForward(ctx, cfg, opts, os.Stdout, log)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"vector-quant-monitor/internal/backfill"
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/monitor"
+	"vector-quant-monitor/internal/supervisor"
+	"vector-quant-monitor/internal/vector"
+	"vector-quant-monitor/util"
+)
+
+type componentOptions struct {
+	hostInterval       time.Duration
+	backfillSchedule   string
+	backfillLookback   int
+	naiveCheckSchedule string
+	naiveCheck         vector.CheckOptions
+}
+
+type componentBuilder func(cfg *config.AppConfig, opts componentOptions, log *slog.Logger) (supervisor.Component, error)
+
+// componentBuilders lists everything "vqm run" can supervise, new monitors only need an entry here
+var componentBuilders = map[string]componentBuilder{
+	"host": func(cfg *config.AppConfig, opts componentOptions, log *slog.Logger) (supervisor.Component, error) {
+		return supervisor.Func("host", func(ctx context.Context) error {
+			return monitor.StartMonitorHost(ctx, cfg, opts.hostInterval, util.ComponentLogger("host"))
+		}), nil
+	},
+	"userstream": func(cfg *config.AppConfig, opts componentOptions, log *slog.Logger) (supervisor.Component, error) {
+		return supervisor.Func("userstream", func(ctx context.Context) error {
+			return monitor.StartFuturesUserStream(ctx, cfg, util.ComponentLogger("userstream"))
+		}), nil
+	},
+	"backfill": func(cfg *config.AppConfig, opts componentOptions, log *slog.Logger) (supervisor.Component, error) {
+		log = util.ComponentLogger("backfill")
+		return supervisor.Scheduled("backfill", opts.backfillSchedule, func(ctx context.Context) error {
+			store, err := db.Connect(cfg.Database, log)
+			if err != nil {
+				return err
+			}
+			defer store.DB.Close()
+			return backfill.RunJob(ctx, cfg, store, opts.backfillLookback, cfg.Backfill.Symbols, nil, log)
+		}, log)
+	},
+	"naive-check": func(cfg *config.AppConfig, opts componentOptions, log *slog.Logger) (supervisor.Component, error) {
+		log = util.ComponentLogger("naive-check")
+		return supervisor.Scheduled("naive-check", opts.naiveCheckSchedule, func(ctx context.Context) error {
+			return vector.StartNaivePredictionCheck(ctx, cfg, opts.naiveCheck, log)
+		}, log)
+	},
+}
+
+func componentNames() []string {
+	names := make([]string, 0, len(componentBuilders))
+	for name := range componentBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/monitor"
+)
+
+func runHost(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	fs := newFlagSet("host", "[flags]")
+	interval := fs.Duration("interval",
+		time.Duration(cfg.Worker.HostMetricIntervalSeconds)*time.Second,
+		"time between host samples")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(fs.Output(), "--interval must be positive")
+		fs.Usage()
+		return errUsage
+	}
+
+	return monitor.StartMonitorHost(ctx, cfg, *interval, log)
+}
@@ -0,0 +1,208 @@
+// vqm runs the vector-quant-monitor jobs.
+//
+//	vqm <command> [flags]
+//
+// Run "vqm <command> --help" for the flags of a command.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/httpserver"
+	"vector-quant-monitor/util"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error
+}
+
+var commands = []command{
+	{"host", "Collect host metrics, store them and evaluate alert rules", runHost},
+	{"userstream", "Persist the Binance futures user-data stream", runUserStream},
+	{"naive-check", "Evaluate the kNN prediction on random patterns", runNaiveCheck},
+	{"backtest", "Walk-forward evaluation of the kNN prediction over a date range", runBacktest},
+	{"backfill", "Rebuild position history from Binance trades", runBackfill},
+	{"migrate", "Apply, revert or list database migrations", runMigrate},
+	{"run", "Supervise several components in one process", runSupervised},
+}
+
+// errUsage marks invalid invocations, they exit with 2 instead of 1
+var errUsage = errors.New("usage error")
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "vqm: unknown command %q\n\n", args[0])
+		printUsage()
+		return 2
+	}
+
+	log := util.NewLogger(slog.LevelInfo.String(), cmd.name)
+
+	// Flag defaults come from the environment, secrets are skipped when only help is printed
+	cfg := config.LoadEnvConfig()
+	if !wantsHelp(args[1:]) {
+		config.ApplyAwsSecrets(cfg)
+	}
+
+	// SIGINT/SIGTERM cancel ctx, commands then get ShutdownTimeoutSeconds to wind down
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// SIGUSR1 toggles debug logging, /loglevel on the HTTP server can change single components
+	util.WatchLevelSignal(ctx, log)
+
+	// Optional /metrics, /healthz, /readyz and /loglevel endpoints, a failing listener doesn't stop the command
+	if cfg.HTTP.Addr != "" && !wantsHelp(args[1:]) {
+		go func() {
+			if err := httpserver.Serve(ctx, cfg.HTTP.Addr, httpserver.NewMux(cfg.HTTP), log); err != nil {
+				log.Error(fmt.Sprintf("HTTP server failed: %v", err))
+			}
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.run(ctx, args[1:], cfg, log)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		timeout := time.Duration(cfg.Worker.ShutdownTimeoutSeconds) * time.Second
+		log.Info(fmt.Sprintf("Shutdown requested, waiting up to %s for %s to stop", timeout, cmd.name))
+		select {
+		case err = <-done:
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+		case <-time.After(timeout):
+			log.Error(fmt.Sprintf("%s did not stop within %s", cmd.name, timeout))
+			return 1
+		}
+	}
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		log.Error(fmt.Sprintf("%s failed: %v", cmd.name, err))
+		return 1
+	}
+}
+
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		if arg == "-h" || arg == "-help" || arg == "--help" || arg == "--h" {
+			return true
+		}
+	}
+	return false
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: vqm <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "vqm <command> --help" for the flags of a command.`)
+}
+
+// newFlagSet prints errors and help to stderr and lets the caller decide the exit code
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: vqm %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags turns flag errors other than --help into errUsage
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return errUsage
+}
+
+// dateValue is a flag.Value for UTC dates (2006-01-02), empty leaves the time zero
+type dateValue struct{ t *time.Time }
+
+func (d dateValue) String() string {
+	if d.t == nil || d.t.IsZero() {
+		return ""
+	}
+	return d.t.Format(time.DateOnly)
+}
+
+func (d dateValue) Set(s string) error {
+	if s == "" {
+		*d.t = time.Time{}
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return err
+	}
+	*d.t = t
+	return nil
+}
+
+// listValue is a flag.Value for comma separated lists, empty leaves the list empty
+type listValue struct{ list *[]string }
+
+func (l listValue) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l listValue) Set(s string) error {
+	*l.list = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l.list = append(*l.list, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/migrate"
+)
+
+func runMigrate(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	fs := newFlagSet("migrate", "up | down [steps] | status")
+	embeddingDim := fs.Int("embedding-dim", cfg.Migrate.EmbeddingDim,
+		"dimension of market_pattern_go.embedding when the table has to be created")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	store, err := db.Connect(cfg.Database, log)
+	if err != nil {
+		return err
+	}
+	defer store.DB.Close()
+
+	migrator := migrate.NewMigrator(store.DB, map[string]string{
+		"EMBEDDING_DIM": strconv.Itoa(*embeddingDim),
+	}, log)
+
+	switch fs.Arg(0) {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			steps, err = strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				fs.Usage()
+				return errUsage
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(os.Stdout, "%04d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
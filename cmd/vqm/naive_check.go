@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/vector"
+)
+
+func runNaiveCheck(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	opts := vector.DefaultCheckOptions()
+
+	fs := newFlagSet("naive-check", "[flags]")
+	fs.IntVar(&opts.Iterations, "iterations", opts.Iterations, "random query rows to evaluate")
+	fs.Var(listValue{&opts.Query.Symbols}, "symbols", "comma separated symbols the query rows are sampled from, empty for any")
+	fs.Var(listValue{&opts.Query.Intervals}, "intervals", "comma separated candle intervals the query rows are sampled from, empty for any")
+	predictors := neighborFlags(fs, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkNeighborFlags(fs, &opts, predictors); err != nil {
+		return err
+	}
+	if err := checkIntervals(fs, opts.Query.Intervals); err != nil {
+		return err
+	}
+	if opts.Iterations < 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	return vector.StartNaivePredictionCheck(ctx, cfg, opts, log)
+}
+
+// predictorFlags hold the predictor flags until checkNeighborFlags builds them
+type predictorFlags struct {
+	list   string
+	params vector.PredictorParams
+}
+
+// neighborFlags registers the neighbor search flags shared by naive-check and backtest
+func neighborFlags(fs *flag.FlagSet, opts *vector.CheckOptions) *predictorFlags {
+	fs.IntVar(&opts.K, "k", opts.K, "neighbors per prediction")
+	fs.Var(listValue{&opts.NeighborSymbols}, "neighbor-symbols", "comma separated symbols of the neighbor patterns, empty for the query's, * for any")
+	fs.Var(listValue{&opts.NeighborIntervals}, "neighbor-intervals", "comma separated candle intervals of the neighbor patterns, empty for the query's")
+	fs.Func("target", "label to predict: "+strings.Join(targetNames(), ", ")+" (default "+string(opts.Target)+")", func(s string) error {
+		target, err := db.ParseTarget(s)
+		opts.Target = target
+		return err
+	})
+	fs.IntVar(&opts.Horizon, "horizon", opts.Horizon, "candles the label looks ahead, neighbors are used only once it is known; 0 follows the target")
+	fs.DurationVar(&opts.Embargo, "embargo", opts.Embargo, "extra window before the query without neighbors")
+	fs.Var(dateValue{&opts.TrainFrom}, "train-from", "first day (UTC) of the neighbor train period, empty for no limit")
+	fs.Var(dateValue{&opts.TrainTo}, "train-to", "last day (UTC) of the neighbor train period, empty for no limit")
+
+	p := &predictorFlags{list: "majority", params: vector.DefaultPredictorParams()}
+	fs.StringVar(&p.list, "predictors", p.list, "comma separated predictors to compare: "+strings.Join(vector.PredictorNames, ", "))
+	fs.Float64Var(&p.params.KernelBandwidth, "kernel-bandwidth", p.params.KernelBandwidth, "cosine distance bandwidth of the kernel predictor, 0 adapts to the farthest neighbor")
+	fs.Float64Var(&p.params.CutoffDistance, "cutoff-distance", p.params.CutoffDistance, "cosine distance beyond which the cutoff predictor ignores neighbors")
+	fs.IntVar(&p.params.CutoffMinNeighbors, "cutoff-min-neighbors", p.params.CutoffMinNeighbors, "close neighbors the cutoff predictor needs to decide")
+	return p
+}
+
+// checkNeighborFlags validates the parsed neighbor flags, builds the predictors
+// and makes the train period end inclusive
+func checkNeighborFlags(fs *flag.FlagSet, opts *vector.CheckOptions, p *predictorFlags) error {
+	if !opts.TrainTo.IsZero() {
+		// Include the whole last day
+		opts.TrainTo = opts.TrainTo.Add(24*time.Hour - time.Second)
+	}
+	if err := checkIntervals(fs, opts.NeighborIntervals); err != nil {
+		return err
+	}
+	if opts.K < 1 || opts.Horizon < 0 || opts.Embargo < 0 || p.params.KernelBandwidth < 0 || p.params.CutoffDistance <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	predictors, err := vector.ParsePredictors(p.list, p.params)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return errUsage
+	}
+	opts.Predictors = predictors
+	return nil
+}
+
+// checkIntervals rejects candle intervals the embargo can't measure
+func checkIntervals(fs *flag.FlagSet, intervals []string) error {
+	for _, interval := range intervals {
+		if _, err := vector.IntervalDuration(interval); err != nil {
+			fmt.Fprintln(fs.Output(), err)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+func targetNames() []string {
+	names := make([]string, len(db.Targets))
+	for i, t := range db.Targets {
+		names[i] = string(t)
+	}
+	return names
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/supervisor"
+	"vector-quant-monitor/internal/vector"
+)
+
+func runSupervised(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	opts := componentOptions{naiveCheck: vector.DefaultCheckOptions()}
+
+	fs := newFlagSet("run", "[flags]")
+	components := fs.String("components", "host",
+		"comma separated components to run: "+strings.Join(componentNames(), ", "))
+	fs.DurationVar(&opts.hostInterval, "host-interval",
+		time.Duration(cfg.Worker.HostMetricIntervalSeconds)*time.Second,
+		"time between host samples")
+	fs.StringVar(&opts.backfillSchedule, "backfill-schedule", "@hourly", "cron spec of the backfill")
+	fs.IntVar(&opts.backfillLookback, "backfill-lookback", 2, "hours of trade history each backfill rebuilds")
+	fs.StringVar(&opts.naiveCheckSchedule, "naive-check-schedule", "@daily", "cron spec of the naive prediction check")
+	fs.IntVar(&opts.naiveCheck.K, "naive-check-k", opts.naiveCheck.K, "neighbors per prediction")
+	fs.IntVar(&opts.naiveCheck.Iterations, "naive-check-iterations", opts.naiveCheck.Iterations, "random query rows per check")
+	fs.DurationVar(&opts.naiveCheck.Embargo, "naive-check-embargo", opts.naiveCheck.Embargo, "extra window before the query without neighbors")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if opts.hostInterval <= 0 {
+		fmt.Fprintln(fs.Output(), "--host-interval must be positive")
+		fs.Usage()
+		return errUsage
+	}
+
+	var supervised []supervisor.Component
+	for _, name := range strings.Split(*components, ",") {
+		name = strings.TrimSpace(name)
+		build, ok := componentBuilders[name]
+		if !ok {
+			fmt.Fprintf(fs.Output(), "unknown component %q\n", name)
+			fs.Usage()
+			return errUsage
+		}
+		component, err := build(cfg, opts, log)
+		if err != nil {
+			return err
+		}
+		supervised = append(supervised, component)
+	}
+
+	sup, err := supervisor.New(supervised, log)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return errUsage
+	}
+	return sup.Run(ctx)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/monitor"
+)
+
+func runUserStream(ctx context.Context, args []string, cfg *config.AppConfig, log *slog.Logger) error {
+	fs := newFlagSet("userstream", "[flags]")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	return monitor.StartFuturesUserStream(ctx, cfg, log)
+}
@@ -0,0 +1,146 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vector-quant-monitor/internal/notifier"
+)
+
+type Status string
+
+const (
+	StatusFiring   Status = "firing"
+	StatusResolved Status = "resolved"
+)
+
+// Sample is one reading of every metric at the same point in time
+type Sample struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// MetricSource produces samples for the engine, the host monitor implements it with gopsutil
+type MetricSource interface {
+	Sample() (Sample, error)
+}
+
+type Event struct {
+	Rule   Rule
+	Status Status
+	Value  float64
+	Time   time.Time
+	Since  time.Time // when the condition started, for resolved events when it fired
+}
+
+type ruleState struct {
+	pendingSince time.Time
+	firing       bool
+	firedAt      time.Time
+}
+
+type Engine struct {
+	rules  []Rule
+	states map[string]*ruleState
+}
+
+func NewEngine(rules []Rule) *Engine {
+	states := make(map[string]*ruleState, len(rules))
+	for _, r := range rules {
+		states[r.Name] = &ruleState{}
+	}
+	return &Engine{rules: rules, states: states}
+}
+
+// Evaluate advances every rule with the sample and returns the transitions it caused
+func (e *Engine) Evaluate(s Sample) []Event {
+	var events []Event
+
+	for _, rule := range e.rules {
+		value, ok := s.Values[rule.Metric]
+		if !ok {
+			continue
+		}
+		st := e.states[rule.Name]
+
+		if st.firing {
+			if rule.recovered(value) {
+				events = append(events, Event{
+					Rule:   rule,
+					Status: StatusResolved,
+					Value:  value,
+					Time:   s.Time,
+					Since:  st.firedAt,
+				})
+				*st = ruleState{}
+			}
+			continue
+		}
+
+		if !rule.breached(value) {
+			st.pendingSince = time.Time{}
+			continue
+		}
+
+		if st.pendingSince.IsZero() {
+			st.pendingSince = s.Time
+		}
+		if s.Time.Sub(st.pendingSince) >= rule.For.Duration {
+			st.firing = true
+			st.firedAt = s.Time
+			events = append(events, Event{
+				Rule:   rule,
+				Status: StatusFiring,
+				Value:  value,
+				Time:   s.Time,
+				Since:  st.pendingSince,
+			})
+		}
+	}
+
+	return events
+}
+
+// Firing lists the names of the rules currently in firing state
+func (e *Engine) Firing() []string {
+	var names []string
+	for _, rule := range e.rules {
+		if e.states[rule.Name].firing {
+			names = append(names, rule.Name)
+		}
+	}
+	return names
+}
+
+func (ev Event) Message() notifier.Message {
+	severity := ev.Rule.Severity
+	title := fmt.Sprintf("[%s] %s", severity, ev.Rule.Name)
+	if ev.Status == StatusResolved {
+		severity = notifier.SeverityResolved
+		title = fmt.Sprintf("[resolved] %s", ev.Rule.Name)
+	}
+
+	return notifier.Message{
+		Title:       title,
+		Description: fmt.Sprintf("%s %s %.2f", ev.Rule.Metric, ev.Rule.Operator, ev.Rule.Threshold),
+		Severity:    severity,
+		Timestamp:   ev.Time,
+		Fields: []notifier.Field{
+			{Name: "Metric", Value: ev.Rule.Metric, Inline: true},
+			{Name: "Value", Value: fmt.Sprintf("%.2f", ev.Value), Inline: true},
+			{Name: "Since", Value: ev.Since.UTC().Format(time.RFC3339), Inline: true},
+		},
+	}
+}
+
+// Route sends every event to the notifier, returning the first error after trying all of them
+func Route(ctx context.Context, n notifier.Notifier, events []Event) error {
+	var firstErr error
+	for _, ev := range events {
+		if err := n.Notify(ctx, ev.Message()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
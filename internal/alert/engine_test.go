@@ -0,0 +1,197 @@
+package alert
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/notifier"
+)
+
+// fakeSource replays scripted samples, one per call
+type fakeSource struct {
+	samples []Sample
+}
+
+func (f *fakeSource) Sample() (Sample, error) {
+	if len(f.samples) == 0 {
+		return Sample{}, errors.New("no more samples")
+	}
+	s := f.samples[0]
+	f.samples = f.samples[1:]
+	return s, nil
+}
+
+var _ MetricSource = (*fakeSource)(nil)
+
+var t0 = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// series builds one sample of metric per minute
+func series(metric string, values ...float64) *fakeSource {
+	src := &fakeSource{}
+	for i, v := range values {
+		src.samples = append(src.samples, Sample{
+			Time:   t0.Add(time.Duration(i) * time.Minute),
+			Values: map[string]float64{metric: v},
+		})
+	}
+	return src
+}
+
+func ptr(v float64) *float64 { return &v }
+
+// transition is an event at the index of the sample that caused it
+type transition struct {
+	sample int
+	status Status
+}
+
+func TestEngineTransitions(t *testing.T) {
+	diskRule := Rule{
+		Name:      "disk",
+		Metric:    "disk_pct",
+		Operator:  OperatorAbove,
+		Threshold: 90,
+		Severity:  notifier.SeverityCritical,
+	}
+	withFor := func(r Rule, d time.Duration) Rule { r.For = Duration{d}; return r }
+	withRecovery := func(r Rule, v float64) Rule { r.Recovery = ptr(v); return r }
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		source *fakeSource
+		want   []transition
+	}{
+		{
+			name:   "fires immediately without for",
+			rule:   diskRule,
+			source: series("disk_pct", 50, 95, 96),
+			want:   []transition{{1, StatusFiring}},
+		},
+		{
+			name:   "equal to threshold does not fire",
+			rule:   diskRule,
+			source: series("disk_pct", 90, 90),
+		},
+		{
+			name:   "fires once sustained for the duration",
+			rule:   withFor(diskRule, 2*time.Minute),
+			source: series("disk_pct", 95, 95, 95, 95),
+			want:   []transition{{2, StatusFiring}},
+		},
+		{
+			name:   "dip below threshold resets the pending timer",
+			rule:   withFor(diskRule, 2*time.Minute),
+			source: series("disk_pct", 95, 95, 80, 95, 95, 95),
+			want:   []transition{{5, StatusFiring}},
+		},
+		{
+			name:   "resolves below the threshold without recovery",
+			rule:   diskRule,
+			source: series("disk_pct", 95, 89, 95),
+			want:   []transition{{0, StatusFiring}, {1, StatusResolved}, {2, StatusFiring}},
+		},
+		{
+			name:   "hysteresis keeps firing between recovery and threshold",
+			rule:   withRecovery(diskRule, 85),
+			source: series("disk_pct", 95, 88, 86, 84),
+			want:   []transition{{0, StatusFiring}, {3, StatusResolved}},
+		},
+		{
+			name: "below operator",
+			rule: Rule{
+				Name:      "free_mem",
+				Metric:    "mem_free_pct",
+				Operator:  OperatorBelow,
+				Threshold: 10,
+				Recovery:  ptr(20),
+			},
+			source: series("mem_free_pct", 30, 5, 15, 25),
+			want:   []transition{{1, StatusFiring}, {3, StatusResolved}},
+		},
+		{
+			name:   "samples without the metric are skipped",
+			rule:   diskRule,
+			source: series("cpu_pct", 99, 99),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); err != nil {
+				t.Fatalf("invalid rule: %v", err)
+			}
+			engine := NewEngine([]Rule{tt.rule})
+
+			var got []transition
+			for i := 0; ; i++ {
+				sample, err := tt.source.Sample()
+				if err != nil {
+					break
+				}
+				for _, ev := range engine.Evaluate(sample) {
+					if ev.Rule.Name != tt.rule.Name || !ev.Time.Equal(sample.Time) {
+						t.Errorf("unexpected event %+v", ev)
+					}
+					got = append(got, transition{i, ev.Status})
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got transitions %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("transition %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEngineEventTimes(t *testing.T) {
+	rule := Rule{Name: "cpu", Metric: "cpu_pct", Operator: OperatorAbove, Threshold: 80, For: Duration{time.Minute}}
+	engine := NewEngine([]Rule{rule})
+	src := series("cpu_pct", 90, 90, 50)
+
+	var events []Event
+	for {
+		sample, err := src.Sample()
+		if err != nil {
+			break
+		}
+		events = append(events, engine.Evaluate(sample)...)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	firing, resolved := events[0], events[1]
+	if !firing.Since.Equal(t0) || !firing.Time.Equal(t0.Add(time.Minute)) {
+		t.Errorf("firing since %s at %s, want since %s", firing.Since, firing.Time, t0)
+	}
+	if !resolved.Since.Equal(firing.Time) {
+		t.Errorf("resolved since %s, want the firing time %s", resolved.Since, firing.Time)
+	}
+	if msg := resolved.Message(); msg.Severity != notifier.SeverityResolved {
+		t.Errorf("resolved message severity %s", msg.Severity)
+	}
+	if got := engine.Firing(); len(got) != 0 {
+		t.Errorf("still firing %v after resolve", got)
+	}
+}
+
+func TestEngineRulesAreIndependent(t *testing.T) {
+	engine := NewEngine([]Rule{
+		{Name: "cpu", Metric: "cpu_pct", Operator: OperatorAbove, Threshold: 80},
+		{Name: "disk", Metric: "disk_pct", Operator: OperatorAbove, Threshold: 90},
+	})
+
+	events := engine.Evaluate(Sample{Time: t0, Values: map[string]float64{"cpu_pct": 95, "disk_pct": 50}})
+	if len(events) != 1 || events[0].Rule.Name != "cpu" {
+		t.Fatalf("got events %+v, want cpu firing", events)
+	}
+	if got := engine.Firing(); len(got) != 1 || got[0] != "cpu" {
+		t.Errorf("firing %v, want [cpu]", got)
+	}
+}
@@ -0,0 +1,172 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"vector-quant-monitor/internal/notifier"
+)
+
+const (
+	OperatorAbove = ">"
+	OperatorBelow = "<"
+)
+
+// Rule fires once Metric stays past Threshold for at least For and resolves
+// only when the metric crosses back over Recovery (hysteresis).
+type Rule struct {
+	Name      string            `json:"name"`
+	Metric    string            `json:"metric"`
+	Operator  string            `json:"operator"`
+	Threshold float64           `json:"threshold"`
+	Recovery  *float64          `json:"recovery,omitempty"` // defaults to Threshold
+	For       Duration          `json:"for"`
+	Severity  notifier.Severity `json:"severity"`
+}
+
+// Duration accepts either "5m" style strings or plain seconds in JSON
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var raw any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (r Rule) recoveryValue() float64 {
+	if r.Recovery != nil {
+		return *r.Recovery
+	}
+	return r.Threshold
+}
+
+func (r Rule) breached(value float64) bool {
+	if r.Operator == OperatorBelow {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+func (r Rule) recovered(value float64) bool {
+	if r.Operator == OperatorBelow {
+		return value > r.recoveryValue()
+	}
+	return value < r.recoveryValue()
+}
+
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule is missing a name")
+	}
+	if r.Metric == "" {
+		return fmt.Errorf("rule %s is missing a metric", r.Name)
+	}
+	if r.Operator != OperatorAbove && r.Operator != OperatorBelow {
+		return fmt.Errorf("rule %s has invalid operator %q", r.Name, r.Operator)
+	}
+	if r.For.Duration < 0 {
+		return fmt.Errorf("rule %s has negative duration", r.Name)
+	}
+	// Recovery on the wrong side of the threshold would resolve on the same sample it fires
+	if r.Operator == OperatorAbove && r.recoveryValue() > r.Threshold {
+		return fmt.Errorf("rule %s recovery must be <= threshold", r.Name)
+	}
+	if r.Operator == OperatorBelow && r.recoveryValue() < r.Threshold {
+		return fmt.Errorf("rule %s recovery must be >= threshold", r.Name)
+	}
+	return nil
+}
+
+// LoadRules reads a JSON array of rules, falling back to DefaultRules when path is empty
+func LoadRules(path string) ([]Rule, error) {
+	if path == "" {
+		return DefaultRules(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse alert rules %s: %w", path, err)
+	}
+
+	// The engine keeps its state by rule name
+	seen := make(map[string]bool, len(rules))
+	for i := range rules {
+		if seen[rules[i].Name] {
+			return nil, fmt.Errorf("duplicate alert rule name %q in %s", rules[i].Name, path)
+		}
+		seen[rules[i].Name] = true
+
+		if rules[i].Operator == "" {
+			rules[i].Operator = OperatorAbove
+		}
+		if rules[i].Severity == "" {
+			rules[i].Severity = notifier.SeverityWarning
+		}
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func DefaultRules() []Rule {
+	diskRecovery := 85.0
+	memRecovery := 85.0
+	cpuRecovery := 80.0
+	return []Rule{
+		{
+			Name:      "host_disk_almost_full",
+			Metric:    "disk_pct",
+			Operator:  OperatorAbove,
+			Threshold: 90,
+			Recovery:  &diskRecovery,
+			For:       Duration{5 * time.Minute},
+			Severity:  notifier.SeverityCritical,
+		},
+		{
+			Name:      "host_memory_high",
+			Metric:    "mem_pct",
+			Operator:  OperatorAbove,
+			Threshold: 90,
+			Recovery:  &memRecovery,
+			For:       Duration{5 * time.Minute},
+			Severity:  notifier.SeverityWarning,
+		},
+		{
+			Name:      "host_cpu_high",
+			Metric:    "cpu_pct",
+			Operator:  OperatorAbove,
+			Threshold: 95,
+			Recovery:  &cpuRecovery,
+			For:       Duration{10 * time.Minute},
+			Severity:  notifier.SeverityWarning,
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package alert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/notifier"
+)
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+		check   func(t *testing.T, rules []Rule)
+	}{
+		{
+			name: "defaults for operator and severity",
+			json: `[{"name": "disk", "metric": "disk_pct", "threshold": 90, "for": "5m"}]`,
+			check: func(t *testing.T, rules []Rule) {
+				r := rules[0]
+				if r.Operator != OperatorAbove || r.Severity != notifier.SeverityWarning || r.For.Duration != 5*time.Minute {
+					t.Errorf("got %+v", r)
+				}
+			},
+		},
+		{
+			name: "for in seconds",
+			json: `[{"name": "disk", "metric": "disk_pct", "threshold": 90, "for": 90}]`,
+			check: func(t *testing.T, rules []Rule) {
+				if rules[0].For.Duration != 90*time.Second {
+					t.Errorf("for %s", rules[0].For)
+				}
+			},
+		},
+		{
+			name: "duplicate names",
+			json: `[
+				{"name": "disk", "metric": "disk_pct", "threshold": 90},
+				{"name": "disk", "metric": "disk_pct", "threshold": 95}
+			]`,
+			wantErr: `duplicate alert rule name "disk"`,
+		},
+		{
+			name:    "recovery on the wrong side",
+			json:    `[{"name": "disk", "metric": "disk_pct", "threshold": 90, "recovery": 95}]`,
+			wantErr: "recovery must be <= threshold",
+		},
+		{
+			name:    "invalid operator",
+			json:    `[{"name": "disk", "metric": "disk_pct", "operator": ">=", "threshold": 90}]`,
+			wantErr: "invalid operator",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			rules, err := LoadRules(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRules: %v", err)
+			}
+			tt.check(t, rules)
+		})
+	}
+}
+
+func TestDefaultRulesAreValid(t *testing.T) {
+	rules, err := LoadRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+}
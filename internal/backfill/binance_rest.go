@@ -0,0 +1,105 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+)
+
+const maxRateLimitRetries = 3
+
+// restClient signs USDⓈ-M futures requests and spends weight from a shared limiter
+type restClient struct {
+	ApiKey    string
+	SecretKey string
+	BaseURL   string
+	client    *http.Client
+	limiter   *weightLimiter
+	prices    *priceCache
+	log       *slog.Logger
+}
+
+func newRestClient(cfg *config.AppConfig, log *slog.Logger) *restClient {
+	return &restClient{
+		ApiKey:    cfg.Binance.ApiKey,
+		SecretKey: cfg.Binance.ApiSecret,
+		BaseURL:   BaseURL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		limiter:   newWeightLimiter(cfg.Backfill.WeightPerMinute),
+		prices:    newPriceCache(),
+		log:       log,
+	}
+}
+
+func (c *restClient) signedGet(ctx context.Context, path string, params url.Values, weight int) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx, weight); err != nil {
+			return nil, err
+		}
+
+		params.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		queryStr := params.Encode()
+		signature := computeHmac256(queryStr, c.SecretKey)
+		fullURL := fmt.Sprintf("%s%s?%s&signature=%s", c.BaseURL, path, queryStr, signature)
+
+		req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-MBX-APIKEY", c.ApiKey)
+
+		started := time.Now()
+		resp, err := c.client.Do(req)
+		if err != nil {
+			apiErrorsTotal.Inc(path, "0")
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		apiRequestDuration.Observe(time.Since(started).Seconds(), path)
+		if err != nil {
+			apiErrorsTotal.Inc(path, "0")
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			apiErrorsTotal.Inc(path, strconv.Itoa(resp.StatusCode))
+			c.log.Warn("Binance API error",
+				"path", path,
+				"status", resp.StatusCode,
+				"body", string(body),
+				"attempt", attempt+1,
+			)
+		}
+
+		if used, err := strconv.Atoi(resp.Header.Get("X-MBX-USED-WEIGHT-1M")); err == nil {
+			c.limiter.Observe(used)
+		}
+
+		// 429 asks us to back off, 418 means we ignored that and got banned
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			wait := time.Minute
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+			c.log.Info("Binance rate limit hit, backing off", "path", path, "wait", wait.String())
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("API Error %d on %s: %s", resp.StatusCode, path, string(body))
+		}
+		return body, nil
+	}
+}
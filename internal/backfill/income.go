@@ -0,0 +1,112 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Income is one row of /fapi/v1/income (REALIZED_PNL, COMMISSION, FUNDING_FEE, ...)
+type Income struct {
+	Symbol     string `json:"symbol"`
+	IncomeType string `json:"incomeType"`
+	Income     string `json:"income"`
+	Asset      string `json:"asset"`
+	Time       int64  `json:"time"`
+	TranId     int64  `json:"tranId"`
+	TradeId    string `json:"tradeId"`
+}
+
+const incomePageLimit = 1000
+
+// fetchIncome pages through the income history between startTime and endTime (ms)
+func (c *restClient) fetchIncome(ctx context.Context, startTime int64, endTime int64) ([]Income, error) {
+	var all []Income
+	seen := make(map[int64]bool)
+
+	for currentStart := startTime; currentStart < endTime; {
+		params := url.Values{}
+		params.Add("startTime", strconv.FormatInt(currentStart, 10))
+		params.Add("endTime", strconv.FormatInt(endTime, 10))
+		params.Add("limit", strconv.Itoa(incomePageLimit))
+
+		body, err := c.signedGet(ctx, "/fapi/v1/income", params, weightIncome)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []Income
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, inc := range page {
+			if !seen[inc.TranId] {
+				seen[inc.TranId] = true
+				all = append(all, inc)
+			}
+		}
+
+		if len(page) < incomePageLimit {
+			break
+		}
+		// Rows come back oldest first. Continue at the last one's millisecond,
+		// rows sharing it come back again and are dropped by tranId.
+		next := page[len(page)-1].Time
+		if next <= currentStart {
+			// A whole page inside one millisecond, the rest of it can't be reached
+			c.log.Warn("Income page did not advance, skipping the millisecond", "time", time.UnixMilli(currentStart).UTC())
+			next = currentStart + 1
+		}
+		currentStart = next
+	}
+
+	return all, nil
+}
+
+// symbolsFromIncome lists every symbol that had trading activity in the income history
+func symbolsFromIncome(incomes []Income) []string {
+	seen := make(map[string]bool)
+	for _, inc := range incomes {
+		switch inc.IncomeType {
+		case "REALIZED_PNL", "COMMISSION", "FUNDING_FEE":
+			if inc.Symbol != "" {
+				seen[inc.Symbol] = true
+			}
+		}
+	}
+
+	symbols := make([]string, 0, len(seen))
+	for s := range seen {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// fundingBySymbol groups FUNDING_FEE rows per symbol, converted to USDT and oldest first
+func (c *restClient) fundingBySymbol(ctx context.Context, incomes []Income) (map[string][]Income, error) {
+	funding := make(map[string][]Income)
+	for _, inc := range incomes {
+		if inc.IncomeType != fundingIncomeType {
+			continue
+		}
+		if inc.Asset != commissionUSDT {
+			rate, err := c.usdtRate(ctx, inc.Asset, inc.Time)
+			if err != nil {
+				return nil, err
+			}
+			amount, _ := strconv.ParseFloat(inc.Income, 64)
+			inc.Income = strconv.FormatFloat(amount*rate, 'f', -1, 64)
+			inc.Asset = commissionUSDT
+		}
+		funding[inc.Symbol] = append(funding[inc.Symbol], inc)
+	}
+	for symbol := range funding {
+		rows := funding[symbol]
+		sort.Slice(rows, func(i, j int) bool { return rows[i].Time < rows[j].Time })
+	}
+	return funding, nil
+}
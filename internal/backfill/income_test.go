@@ -0,0 +1,43 @@
+package backfill
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetchIncomePages(t *testing.T) {
+	// Funding and commission rows share a millisecond across the page boundary
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	binance := &fakeBinance{}
+	for i := range int64(incomePageLimit + 500) {
+		incomeType := "COMMISSION"
+		if i%2 == 0 {
+			incomeType = fundingIncomeType
+		}
+		binance.incomes = append(binance.incomes, Income{
+			Symbol:     "BTCUSDT",
+			IncomeType: incomeType,
+			Income:     "-0.01",
+			Asset:      commissionUSDT,
+			Time:       start + i/3,
+			TranId:     i + 1,
+		})
+	}
+
+	c := binance.client(t)
+	incomes, err := c.fetchIncome(t.Context(), start, start+time.Hour.Milliseconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incomes) != incomePageLimit+500 {
+		t.Fatalf("got %d rows, want all %d", len(incomes), incomePageLimit+500)
+	}
+	for i, inc := range incomes {
+		if inc.TranId != int64(i+1) {
+			t.Fatalf("row %d has tranId %d, want every row once in order", i, inc.TranId)
+		}
+	}
+	if n := binance.requests["/fapi/v1/income"]; n != 2 {
+		t.Errorf("%d requests, want 2 pages", n)
+	}
+}
@@ -0,0 +1,32 @@
+package backfill
+
+import "vector-quant-monitor/internal/metrics"
+
+var (
+	rowsTotal = metrics.NewCounter(
+		"vqm_backfill_rows_total",
+		"Position history rows handled by the backfill, by outcome (inserted, skipped, failed).",
+		"outcome",
+	)
+	runDuration = metrics.NewHistogram(
+		"vqm_backfill_run_duration_seconds",
+		"Duration of backfill runs.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	)
+	runsTotal = metrics.NewCounter(
+		"vqm_backfill_runs_total",
+		"Backfill runs, by result (success, error).",
+		"result",
+	)
+	apiRequestDuration = metrics.NewHistogram(
+		"vqm_binance_api_request_duration_seconds",
+		"Latency of Binance REST requests.",
+		metrics.DefBuckets,
+		"path",
+	)
+	apiErrorsTotal = metrics.NewCounter(
+		"vqm_binance_api_errors_total",
+		"Failed Binance REST requests, by path and HTTP status (0 for transport errors).",
+		"path", "status",
+	)
+)
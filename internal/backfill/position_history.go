@@ -1,25 +1,28 @@
 package backfill
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 	"vector-quant-monitor/internal/config"
-	"vector-quant-monitor/internal/db"
 )
 
 // --- CONFIGURATION ---
 const (
 	BaseURL = "https://fapi.binance.com"
-	Symbol  = "ETHUSDT"
+
+	// Value of trading.position_history.market for USDⓈ-M futures
+	MarketBinanceUSDM = "BINANCE_USDM_FUTURES"
 )
 
 // Raw Trade from Binance
@@ -54,102 +57,132 @@ type OrderGroup struct {
 
 // Final Output Row
 type PositionRow struct {
-	Symbol       string
-	Side         string
-	PositionSide string
-	NetPnl       string // PnL - Commission
-	Vol          string
-	OpenTime     time.Time
-	CloseTime    time.Time
+	Market        string
+	Symbol        string
+	Side          string
+	PositionSide  string
+	GrossPnl      float64 // Realized PnL
+	Fees          float64 // Commission in USDT
+	Funding       float64 // Funding received (+) or paid (-) in USDT
+	NetPnl        string  // GrossPnl - Fees + Funding
+	Vol           string  // Closed quantity
+	AvgEntryPrice float64
+	AvgExitPrice  float64
+	OpenTime      time.Time
+	CloseTime     time.Time
 }
 
-func GetPositionHistory(db *db.Postgresql, LookBackDays int) []PositionRow {
+// GetPositionHistory rebuilds the positions closed between from and to.
+// When symbols is empty every symbol with income in the window is backfilled.
+// A failing symbol doesn't stop the others, its error is joined into the result.
+func GetPositionHistory(ctx context.Context, config *config.AppConfig, from time.Time, to time.Time, symbols []string, log *slog.Logger) ([]PositionRow, error) {
+	client := newRestClient(config, log)
+
+	endTime := to.UnixMilli()
+	startTime := from.UnixMilli()
 
-	// 1. Fetch raw trades
-	rawTrades, err := fetchTradesWithTimeWindow(Symbol, LookBackDays)
+	// 1. Income history gives the funding payments and the symbols traded in the window
+	incomes, err := client.fetchIncome(ctx, startTime, endTime)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return nil
+		return nil, err
 	}
+	funding, err := client.fundingBySymbol(ctx, incomes)
+	if err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 {
+		symbols = symbolsFromIncome(incomes)
+	}
+	log.Info("Backfilling symbols",
+		"symbols", symbols,
+		"incomes", len(incomes),
+		"start", time.UnixMilli(startTime).UTC(),
+		"end", time.UnixMilli(endTime).UTC(),
+	)
+
+	// 2. Reconstruct every symbol concurrently, the shared limiter keeps us under the weight limit
+	results := make([][]PositionRow, len(symbols))
+	errs := make([]error, len(symbols))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for range max(config.Backfill.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// On shutdown the remaining symbols are skipped, what we have is still stored
+				if ctx.Err() != nil {
+					errs[i] = fmt.Errorf("%s: %w", symbols[i], ctx.Err())
+					continue
+				}
+				rows, err := client.symbolPositionHistory(ctx, symbols[i], startTime, endTime, funding[symbols[i]])
+				if err != nil {
+					log.Error("Symbol backfill failed", "symbol", symbols[i], "error", err)
+					errs[i] = fmt.Errorf("%s: %w", symbols[i], err)
+					continue
+				}
+				log.Info("Symbol positions rebuilt", "symbol", symbols[i], "positions", len(rows))
+				results[i] = rows
+			}
+		}()
+	}
+	for i := range symbols {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-	// 2. Group trades by OrderID to handle split fills
-	orderGroups := groupTradesByOrder(rawTrades)
-
-	// 3. Sort groups chronologically to track history
-	sort.Slice(orderGroups, func(i, j int) bool {
-		return orderGroups[i].Time < orderGroups[j].Time
-	})
-
-	// 4. Match Open Times with Close Times
-	// Map to store the Open Time of the current position side
-	activePositions := make(map[string]int64)
 	var history []PositionRow
+	for _, rows := range results {
+		history = append(history, rows...)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].CloseTime.Before(history[j].CloseTime)
+	})
 
-	for _, order := range orderGroups {
-		key := order.PositionSide // "LONG", "SHORT", or "BOTH"
-
-		// LOGIC:
-		// If PnL is 0, it's an OPEN (or add) order.
-		// We only record the time if we don't already have an open start time.
-		if !order.IsClose {
-			if _, exists := activePositions[key]; !exists {
-				activePositions[key] = order.Time
-			}
-		}
+	// Rows of the symbols that worked are still returned so they can be stored
+	return history, errors.Join(errs...)
+}
 
-		// If PnL != 0, it's a CLOSE order.
-		if order.IsClose {
-			openTimeVal, exists := activePositions[key]
+// symbolPositionHistory matches open and close orders of a single symbol
+func (c *restClient) symbolPositionHistory(ctx context.Context, symbol string, startTime int64, endTime int64, funding []Income) ([]PositionRow, error) {
+	// 1. The position held now anchors what was already open at startTime,
+	// trades up to the same moment are needed to walk it back
+	current, err := c.fetchPositionAmounts(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	anchorTime := max(endTime, time.Now().UnixMilli())
 
-			// Calculate Net PnL (Subtract commission if it's in USDT)
-			// If Commission is in BNB, the UI usually converts it, but here we just show raw math for USDT.
-			netPnl := order.TotalPnl
-			if order.CommissionAsset == "USDT" {
-				netPnl = order.TotalPnl - order.TotalCommission
-			}
+	// 2. Fetch raw trades and value BNB (or other) commissions in USDT
+	rawTrades, err := c.fetchTradesWithTimeWindow(ctx, symbol, startTime, anchorTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.convertCommissions(ctx, rawTrades); err != nil {
+		return nil, err
+	}
 
-			var tOpen time.Time
-			if exists {
-				tOpen = time.UnixMilli(openTimeVal) // Converts 17000... to a Time object
-			} else {
-				// Handle edge case where open time is missing (maybe set to close time or epoch)
-				tOpen = time.UnixMilli(order.Time)
-			}
+	// 3. Group trades by OrderID to handle split fills
+	orderGroups := groupTradesByOrder(rawTrades)
 
-			tClose := time.UnixMilli(order.Time)
+	// 4. Sort groups chronologically to track history
+	sort.Slice(orderGroups, func(i, j int) bool {
+		return orderGroups[i].Time < orderGroups[j].Time
+	})
 
-			row := PositionRow{
-				Symbol:       order.Symbol,
-				Side:         order.Side,
-				PositionSide: order.PositionSide, // usually "BOTH" for One-Way mode
-				NetPnl:       fmt.Sprintf("%.2f", netPnl),
-				Vol:          fmt.Sprintf("%.3f", order.TotalQty),
-				OpenTime:     tOpen,
-				CloseTime:    tClose,
-			}
+	// 5. Replay the orders through the position state machine
+	opening := openingPositions(current, orderGroups)
+	var history []PositionRow
+	for _, row := range reconstructPositions(orderGroups, funding, opening) {
+		// Positions closed after the window belong to the next run
+		if row.CloseTime.UnixMilli() <= endTime {
 			history = append(history, row)
-
-			// Logic: If we closed, we assume position is cleared or we wait for next Open.
-			// Note: This simple logic assumes full closes. Partial closes are complex to track perfectly without balance state.
-			// For this specific list, deleting the key resets the timer for the next trade.
-			delete(activePositions, key)
 		}
 	}
 
-	// 5. Print Output (Newest First)
-	fmt.Println("-----------------------------------------------------------------------------------------")
-	fmt.Printf("%-10s | %-6s | %-12s | %-10s | %-20s | %-20s\n",
-		"Symbol", "Side", "Net PnL", "Vol(ETH)", "Opened Time", "Closed Time")
-	fmt.Println("-----------------------------------------------------------------------------------------")
-
-	for i := len(history) - 1; i >= 0; i-- {
-		h := history[i]
-		fmt.Printf("%-10s | %-6s | %-12s | %-10s | %-20s | %-20s\n",
-			h.Symbol, h.Side, h.NetPnl, h.Vol, h.OpenTime, h.CloseTime)
-	}
-	fmt.Println("-----------------------------------------------------------------------------------------")
-
-	return history
+	return history, nil
 }
 
 // --- HELPERS ---
@@ -172,6 +205,7 @@ func groupTradesByOrder(trades []Trade) []*OrderGroup {
 			grp.AvgPrice = totalVal / grp.TotalQty
 			grp.TotalPnl += pnl
 			grp.TotalCommission += comm
+			grp.IsClose = grp.IsClose || pnl != 0
 			// Update time to latest fill time
 			if t.Time > grp.Time {
 				grp.Time = t.Time
@@ -205,20 +239,15 @@ func groupTradesByOrder(trades []Trade) []*OrderGroup {
 	return result
 }
 
-func fetchTradesWithTimeWindow(symbol string, hoursBack int) ([]Trade, error) {
-	config := config.LoadConfig()
-	ApiKey := config.Binance.ApiKey
-	SecretKey := config.Binance.ApiSecret
+const tradesPageLimit = 1000
 
-	client := &http.Client{Timeout: 10 * time.Second}
+// fetchTradesWithTimeWindow pages through the fills of symbol between startTime
+// and endTime (ms). A window longer than the API allows is split into chunks.
+func (c *restClient) fetchTradesWithTimeWindow(ctx context.Context, symbol string, startTime int64, endTime int64) ([]Trade, error) {
 	var allTrades []Trade
+	seen := make(map[int64]bool)
 
-	// 1. Calculate the final end time (Now)
-	endTime := time.Now().UnixMilli()
-	// 2. Calculate the starting point (e.g., 20 days ago)
-	startTime := time.Now().Add(time.Duration(-hoursBack) * time.Hour).UnixMilli()
-
-	// 3. Loop in 7-day (604800000 ms) chunks
+	// Loop in 7-day (604800000 ms) chunks
 	// We use slightly less (6 days) to be safe and avoid edge case overlaps
 	const ChunkSize = 6 * 24 * 60 * 60 * 1000
 
@@ -229,104 +258,64 @@ func fetchTradesWithTimeWindow(symbol string, hoursBack int) ([]Trade, error) {
 			currentEnd = endTime
 		}
 
-		fmt.Printf("Fetching chunk: %s -> %s\n",
-			time.UnixMilli(currentStart).Format("2006-01-02 15:04"),
-			time.UnixMilli(currentEnd).Format("2006-01-02 15:04"),
-		)
-
-		// --- API REQUEST ---
-		params := url.Values{}
-		params.Add("symbol", symbol)
-		params.Add("limit", "1000")
-		params.Add("startTime", strconv.FormatInt(currentStart, 10))
-		params.Add("endTime", strconv.FormatInt(currentEnd, 10))
-		params.Add("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
-
-		queryStr := params.Encode()
-		signature := computeHmac256(queryStr, SecretKey)
-		fullURL := fmt.Sprintf("%s/fapi/v1/userTrades?%s&signature=%s", BaseURL, queryStr, signature)
-
-		req, _ := http.NewRequest("GET", fullURL, nil)
-		req.Header.Set("X-MBX-APIKEY", ApiKey)
-		resp, err := client.Do(req)
-
-		if err != nil {
-			fmt.Println("Network error:", err)
-			return nil, err
-		}
+		// fromId can't be combined with a time window, so a full page is
+		// continued from the time of its last fill. Fills sharing that
+		// millisecond come back again and are dropped by id.
+		for pageStart := currentStart; pageStart <= currentEnd; {
+			params := url.Values{}
+			params.Add("symbol", symbol)
+			params.Add("limit", strconv.Itoa(tradesPageLimit))
+			params.Add("startTime", strconv.FormatInt(pageStart, 10))
+			params.Add("endTime", strconv.FormatInt(currentEnd, 10))
+
+			body, err := c.signedGet(ctx, "/fapi/v1/userTrades", params, weightUserTrades)
+			if err != nil {
+				return nil, err
+			}
 
-		// Handle non-200 errors (like if we hit rate limits)
-		if resp.StatusCode != 200 {
-			body, _ := io.ReadAll(resp.Body)
-			fmt.Printf("API Error %d: %s\n", resp.StatusCode, string(body))
-			resp.Body.Close()
-			return nil, fmt.Errorf("API Error")
-		}
+			var page []Trade
+			if err := json.Unmarshal(body, &page); err != nil {
+				return nil, err
+			}
+			for _, t := range page {
+				if !seen[t.Id] {
+					seen[t.Id] = true
+					allTrades = append(allTrades, t)
+				}
+			}
 
-		var chunk []Trade
-		json.NewDecoder(resp.Body).Decode(&chunk)
-		resp.Body.Close()
+			c.log.Info("Fetched trades page",
+				"symbol", symbol,
+				"start", time.UnixMilli(pageStart).UTC(),
+				"end", time.UnixMilli(currentEnd).UTC(),
+				"trades", len(page),
+				"total", len(allTrades),
+			)
 
-		// Append results
-		if len(chunk) > 0 {
-			allTrades = append(allTrades, chunk...)
+			if len(page) < tradesPageLimit {
+				break
+			}
+			next := page[len(page)-1].Time
+			if next <= pageStart {
+				// A whole page inside one millisecond, the rest of it can't be reached
+				c.log.Warn("Trades page did not advance, skipping the millisecond",
+					"symbol", symbol,
+					"time", time.UnixMilli(pageStart).UTC(),
+				)
+				next = pageStart + 1
+			}
+			pageStart = next
 		}
 
 		// Move valid time forward
 		currentStart = currentEnd + 1
-
-		// Sleep briefly to respect API rate limits
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	return allTrades, nil
 }
 
-func fetchTrades(symbol string, limit int) ([]Trade, error) {
-	config := config.LoadConfig()
-	ApiKey := config.Binance.ApiKey
-	SecretKey := config.Binance.ApiSecret
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	endpoint := "/fapi/v1/userTrades"
-	params := url.Values{}
-	params.Add("symbol", symbol)
-	params.Add("limit", strconv.Itoa(limit))
-	params.Add("timestamp", strconv.FormatInt(time.Now().UnixNano()/1e6, 10))
-
-	queryStr := params.Encode()
-	signature := computeHmac256(queryStr, SecretKey)
-	fullURL := fmt.Sprintf("%s%s?%s&signature=%s", BaseURL, endpoint, queryStr, signature)
-
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("X-MBX-APIKEY", ApiKey)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Status %d", resp.StatusCode)
-	}
-
-	var trades []Trade
-	if err := json.NewDecoder(resp.Body).Decode(&trades); err != nil {
-		return nil, err
-	}
-	return trades, nil
-}
-
 func computeHmac256(message string, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))
 	h.Write([]byte(message))
 	return hex.EncodeToString(h.Sum(nil))
 }
-
-func formatTime(ms int64) string {
-	return time.UnixMilli(ms).Format("2006-01-02 15:04:05")
-}
@@ -0,0 +1,146 @@
+package backfill
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+)
+
+// fakeBinance answers the signed endpoints the backfill calls from fixed data,
+// paging by time and limit like the real API
+type fakeBinance struct {
+	trades    []Trade
+	incomes   []Income
+	positions []PositionRisk
+	requests  map[string]int
+}
+
+func (f *fakeBinance) client(t *testing.T) *restClient {
+	f.requests = make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests[r.URL.Path]++
+		q := r.URL.Query()
+		start, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("endTime"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		inWindow := func(at int64) bool { return at >= start && at <= end }
+
+		var rows []any
+		switch r.URL.Path {
+		case "/fapi/v1/userTrades":
+			for _, tr := range f.trades {
+				if tr.Symbol == q.Get("symbol") && inWindow(tr.Time) {
+					rows = append(rows, tr)
+				}
+			}
+		case "/fapi/v1/income":
+			for _, inc := range f.incomes {
+				if inWindow(inc.Time) {
+					rows = append(rows, inc)
+				}
+			}
+		case "/fapi/v2/positionRisk":
+			for _, p := range f.positions {
+				if p.Symbol == q.Get("symbol") {
+					rows = append(rows, p)
+				}
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if limit > 0 && len(rows) > limit {
+			rows = rows[:limit]
+		}
+		json.NewEncoder(w).Encode(rows)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.AppConfig{Backfill: config.BackfillConfig{WeightPerMinute: 1_000_000}}
+	c := newRestClient(cfg, discard)
+	c.BaseURL = server.URL
+	return c
+}
+
+// fill is a BTCUSDT trade of its own order, oldest first by id
+func fill(id int64, at int64, side string, qty string, price string, pnl string) Trade {
+	return Trade{
+		Id:              id,
+		OrderId:         id,
+		Symbol:          "BTCUSDT",
+		Side:            side,
+		PositionSide:    "BOTH",
+		Qty:             qty,
+		Price:           price,
+		RealizedPnl:     pnl,
+		Commission:      "0.01",
+		CommissionAsset: commissionUSDT,
+		Time:            at,
+	}
+}
+
+func TestFetchTradesPages(t *testing.T) {
+	// Three fills per millisecond, so page boundaries fall inside a millisecond
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	binance := &fakeBinance{}
+	for i := range int64(2500) {
+		binance.trades = append(binance.trades, fill(i+1, start+i/3, "BUY", "0.001", "100", "0"))
+	}
+	// An ETH fill in between doesn't belong to the BTC pages
+	binance.trades = append(binance.trades, Trade{Id: 9999, Symbol: "ETHUSDT", Time: start + 10})
+	sort.SliceStable(binance.trades, func(i, j int) bool { return binance.trades[i].Time < binance.trades[j].Time })
+
+	c := binance.client(t)
+	trades, err := c.fetchTradesWithTimeWindow(t.Context(), "BTCUSDT", start, start+time.Hour.Milliseconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 2500 {
+		t.Fatalf("got %d trades, want all 2500", len(trades))
+	}
+	for i, tr := range trades {
+		if tr.Id != int64(i+1) {
+			t.Fatalf("trade %d has id %d, want every fill once in order", i, tr.Id)
+		}
+	}
+	if n := binance.requests["/fapi/v1/userTrades"]; n != 3 {
+		t.Errorf("%d requests, want 3 pages", n)
+	}
+}
+
+func TestOverlappingWindowsStoreOnePosition(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	binance := &fakeBinance{trades: []Trade{
+		fill(1, start+hour, "BUY", "1", "100", "0"),
+		fill(2, start+3*hour, "SELL", "1", "110", "10"),
+	}}
+	c := binance.client(t)
+	store := db.NewMemoryStore()
+
+	// The first run sees the open, the second starts after it
+	for _, window := range [][2]int64{{start, start + 4*hour}, {start + 2*hour, start + 5*hour}} {
+		rows, err := c.symbolPositionHistory(t.Context(), "BTCUSDT", window[0], window[1], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("window %v: got %d rows, want the one close", window, len(rows))
+		}
+		StorePositionHistory(store, rows, discard)
+	}
+
+	if len(store.Positions) != 1 {
+		t.Fatalf("stored %d positions, want 1", len(store.Positions))
+	}
+	if got := store.Positions[0]; got.OpenTime.UnixMilli() != start+hour || got.AvgEntryPrice != 100 {
+		t.Errorf("stored %+v, want the row with the real open", got)
+	}
+}
@@ -0,0 +1,59 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// PositionRisk is one row of /fapi/v2/positionRisk, the position held right now
+type PositionRisk struct {
+	Symbol       string `json:"symbol"`
+	PositionAmt  string `json:"positionAmt"` // Signed, SHORT rows are negative in hedge mode too
+	PositionSide string `json:"positionSide"`
+}
+
+// fetchPositionAmounts returns the signed quantity held now per position key
+func (c *restClient) fetchPositionAmounts(ctx context.Context, symbol string) (map[string]float64, error) {
+	params := url.Values{}
+	params.Add("symbol", symbol)
+
+	body, err := c.signedGet(ctx, "/fapi/v2/positionRisk", params, weightPositionRisk)
+	if err != nil {
+		return nil, err
+	}
+
+	var risks []PositionRisk
+	if err := json.Unmarshal(body, &risks); err != nil {
+		return nil, err
+	}
+
+	amounts := make(map[string]float64)
+	for _, r := range risks {
+		amt, _ := strconv.ParseFloat(r.PositionAmt, 64)
+		if math.Abs(amt) >= qtyEpsilon {
+			amounts[positionKey(r.Symbol, r.PositionSide)] = amt
+		}
+	}
+	return amounts, nil
+}
+
+// openingPositions walks the current positions back through the orders since the
+// window start, what is left was already open before the first order we saw
+func openingPositions(current map[string]float64, orders []*OrderGroup) map[string]float64 {
+	opening := make(map[string]float64)
+	for key, qty := range current {
+		opening[key] = qty
+	}
+	for _, order := range orders {
+		opening[positionKey(order.Symbol, order.PositionSide)] -= order.signedQty()
+	}
+	for key, qty := range opening {
+		if math.Abs(qty) < qtyEpsilon {
+			delete(opening, key)
+		}
+	}
+	return opening
+}
@@ -0,0 +1,220 @@
+package backfill
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quantities below this are treated as zero to absorb float rounding
+const qtyEpsilon = 1e-9
+
+// positionState follows one symbol/positionSide through its orders.
+// Qty is signed: positive for long, negative for short.
+type positionState struct {
+	Qty           float64
+	OpenTime      int64
+	EntryQty      float64
+	EntryNotional float64
+	ExitQty       float64
+	ExitNotional  float64
+	Pnl           float64
+	Commission    float64
+	Funding       float64
+	PriorQty      float64 // Opened before the window, its entry price is unknown
+}
+
+func (s *positionState) open(order *OrderGroup, signedQty float64, commission float64) {
+	*s = positionState{
+		Qty:           signedQty,
+		OpenTime:      order.Time,
+		EntryQty:      math.Abs(signedQty),
+		EntryNotional: math.Abs(signedQty) * order.AvgPrice,
+		Commission:    commission,
+	}
+}
+
+func positionKey(symbol string, positionSide string) string {
+	return symbol + "|" + positionSide // PositionSide is "LONG", "SHORT", or "BOTH"
+}
+
+func (o *OrderGroup) signedQty() float64 {
+	if o.Side == "SELL" {
+		return -o.TotalQty
+	}
+	return o.TotalQty
+}
+
+// reconstructPositions replays chronologically sorted orders and emits a row
+// every time a position returns to zero. Scale-ins move the average entry,
+// partial closes accumulate into the same row and an order that flips the
+// position (one-way mode) is split into a close and a new open.
+// opening holds the signed quantity per position key already open before the
+// first order, without it a close larger than what we saw opened looks like a flip.
+// Funding payments (USDT, oldest first) are credited to the positions open when they were paid.
+func reconstructPositions(orders []*OrderGroup, funding []Income, opening map[string]float64) []PositionRow {
+	states := make(map[string]*positionState)
+	var history []PositionRow
+
+	for key, qty := range opening {
+		states[key] = &positionState{Qty: qty, PriorQty: math.Abs(qty)}
+	}
+
+	// Funding paid while we saw no open position belongs to one opened before the window
+	orphanFunding := make(map[string]float64)
+	nextFunding := 0
+
+	for _, order := range orders {
+		for ; nextFunding < len(funding) && funding[nextFunding].Time < order.Time; nextFunding++ {
+			applyFunding(states, orphanFunding, funding[nextFunding])
+		}
+
+		key := positionKey(order.Symbol, order.PositionSide)
+		state, exists := states[key]
+		if !exists {
+			state = &positionState{}
+			states[key] = state
+		}
+
+		signedQty := order.signedQty()
+		commission := orderCommission(order)
+
+		// 1. FLAT: a new position starts
+		if math.Abs(state.Qty) < qtyEpsilon {
+			if order.IsClose {
+				// Realized PnL without a known open means the position was opened
+				// before the window, keep the close with the close time as open time
+				state.open(order, 0, commission)
+				state.ExitQty = order.TotalQty
+				state.ExitNotional = order.TotalQty * order.AvgPrice
+				state.Pnl = order.TotalPnl
+				state.Funding = orphanFunding[order.Symbol]
+				delete(orphanFunding, order.Symbol)
+				history = append(history, state.row(order))
+				*state = positionState{}
+				continue
+			}
+			state.open(order, signedQty, commission)
+			continue
+		}
+
+		// 2. SAME DIRECTION: scale in
+		if (state.Qty > 0) == (signedQty > 0) {
+			state.Qty += signedQty
+			state.EntryQty += order.TotalQty
+			state.EntryNotional += order.TotalQty * order.AvgPrice
+			state.Commission += commission
+			continue
+		}
+
+		// 3. OPPOSITE DIRECTION: reduce, close or reverse
+		closeQty := math.Min(order.TotalQty, math.Abs(state.Qty))
+		closeShare := closeQty / order.TotalQty
+
+		state.ExitQty += closeQty
+		state.ExitNotional += closeQty * order.AvgPrice
+		state.Pnl += order.TotalPnl // The opening part of a flip realizes nothing
+		state.Commission += commission * closeShare
+		if state.Qty > 0 {
+			state.Qty -= closeQty
+		} else {
+			state.Qty += closeQty
+		}
+
+		if math.Abs(state.Qty) >= qtyEpsilon {
+			continue
+		}
+
+		history = append(history, state.row(order))
+
+		// Whatever is left over opens a position the other way
+		remaining := order.TotalQty - closeQty
+		if remaining < qtyEpsilon {
+			*state = positionState{}
+			continue
+		}
+		if signedQty < 0 {
+			remaining = -remaining
+		}
+		state.open(order, remaining, commission*(1-closeShare))
+	}
+
+	return history
+}
+
+// applyFunding splits a payment across the open positions of its symbol by size,
+// in hedge mode LONG and SHORT can both be open
+func applyFunding(states map[string]*positionState, orphan map[string]float64, inc Income) {
+	amount, _ := strconv.ParseFloat(inc.Income, 64)
+	prefix := inc.Symbol + "|"
+
+	var totalQty float64
+	for key, state := range states {
+		if strings.HasPrefix(key, prefix) {
+			totalQty += math.Abs(state.Qty)
+		}
+	}
+	if totalQty < qtyEpsilon {
+		orphan[inc.Symbol] += amount
+		return
+	}
+
+	for key, state := range states {
+		if strings.HasPrefix(key, prefix) {
+			state.Funding += amount * math.Abs(state.Qty) / totalQty
+		}
+	}
+}
+
+func (s *positionState) row(closeOrder *OrderGroup) PositionRow {
+	openTime := s.OpenTime
+	if openTime == 0 {
+		// Opened before the window, the close time stands in. Stored positions
+		// are told apart by their close, which every window agrees on.
+		openTime = closeOrder.Time
+	}
+
+	var entryPrice, exitPrice float64
+	if s.EntryQty > 0 {
+		entryPrice = s.EntryNotional / s.EntryQty
+	}
+	if s.ExitQty > 0 {
+		exitPrice = s.ExitNotional / s.ExitQty
+	}
+	if s.PriorQty > 0 && s.ExitQty > 0 {
+		// Binance realizes PnL against the average entry, which gives it back
+		// for the quantity opened before the window
+		if closeOrder.Side == "SELL" {
+			entryPrice = exitPrice - s.Pnl/s.ExitQty
+		} else {
+			entryPrice = exitPrice + s.Pnl/s.ExitQty
+		}
+	}
+
+	return PositionRow{
+		Market:        MarketBinanceUSDM,
+		Symbol:        closeOrder.Symbol,
+		Side:          closeOrder.Side,
+		PositionSide:  closeOrder.PositionSide, // usually "BOTH" for One-Way mode
+		GrossPnl:      s.Pnl,
+		Fees:          s.Commission,
+		Funding:       s.Funding,
+		NetPnl:        fmt.Sprintf("%.2f", s.Pnl-s.Commission+s.Funding),
+		Vol:           fmt.Sprintf("%.3f", s.ExitQty),
+		AvgEntryPrice: entryPrice,
+		AvgExitPrice:  exitPrice,
+		OpenTime:      time.UnixMilli(openTime),
+		CloseTime:     time.UnixMilli(closeOrder.Time),
+	}
+}
+
+// orderCommission expects fills converted by convertCommissions, anything
+// still in another asset can't be valued and is left out
+func orderCommission(order *OrderGroup) float64 {
+	if order.CommissionAsset == commissionUSDT {
+		return order.TotalCommission
+	}
+	return 0
+}
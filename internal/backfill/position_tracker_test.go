@@ -0,0 +1,183 @@
+package backfill
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// order builds a filled order at minute t, fee is paid in USDT
+func order(t int64, side string, positionSide string, qty float64, price float64, pnl float64) *OrderGroup {
+	return &OrderGroup{
+		OrderId:         t,
+		Symbol:          "BTCUSDT",
+		Side:            side,
+		PositionSide:    positionSide,
+		TotalQty:        qty,
+		AvgPrice:        price,
+		TotalPnl:        pnl,
+		TotalCommission: 0.1,
+		CommissionAsset: commissionUSDT,
+		Time:            t * time.Minute.Milliseconds(),
+		IsClose:         pnl != 0,
+	}
+}
+
+func funding(t int64, amount string) Income {
+	return Income{Symbol: "BTCUSDT", IncomeType: fundingIncomeType, Income: amount, Asset: commissionUSDT, Time: t * time.Minute.Milliseconds()}
+}
+
+// wantRow lists the fields a test checks, times are in minutes
+type wantRow struct {
+	positionSide string
+	open, close  int64
+	vol          string
+	entry, exit  float64
+	pnl          float64
+	fees         float64
+	funding      float64
+}
+
+func TestReconstructPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		orders  []*OrderGroup
+		funding []Income
+		opening map[string]float64
+		want    []wantRow
+	}{
+		{
+			name: "open and close",
+			orders: []*OrderGroup{
+				order(1, "BUY", "BOTH", 1, 100, 0),
+				order(2, "SELL", "BOTH", 1, 110, 10),
+			},
+			want: []wantRow{{"BOTH", 1, 2, "1.000", 100, 110, 10, 0.2, 0}},
+		},
+		{
+			name: "partial closes accumulate into one row",
+			orders: []*OrderGroup{
+				order(1, "SELL", "BOTH", 2, 100, 0),
+				order(2, "BUY", "BOTH", 1, 90, 10),
+				order(3, "BUY", "BOTH", 1, 80, 20),
+			},
+			want: []wantRow{{"BOTH", 1, 3, "2.000", 100, 85, 30, 0.3, 0}},
+		},
+		{
+			name: "scale-in moves the average entry",
+			orders: []*OrderGroup{
+				order(1, "BUY", "BOTH", 1, 100, 0),
+				order(2, "BUY", "BOTH", 3, 120, 0),
+				order(3, "SELL", "BOTH", 4, 130, 50),
+			},
+			want: []wantRow{{"BOTH", 1, 3, "4.000", 115, 130, 50, 0.3, 0}},
+		},
+		{
+			name: "reversal splits the order into a close and an open",
+			orders: []*OrderGroup{
+				order(1, "BUY", "BOTH", 1, 100, 0),
+				order(2, "SELL", "BOTH", 3, 110, 10),
+				order(3, "BUY", "BOTH", 2, 105, 10),
+			},
+			want: []wantRow{
+				{"BOTH", 1, 2, "1.000", 100, 110, 10, 0.1 + 0.1/3, 0},
+				{"BOTH", 2, 3, "2.000", 110, 105, 10, 0.1*2/3 + 0.1, 0},
+			},
+		},
+		{
+			name: "hedge mode keeps long and short apart",
+			orders: []*OrderGroup{
+				order(1, "BUY", "LONG", 1, 100, 0),
+				order(2, "SELL", "SHORT", 2, 100, 0),
+				order(3, "BUY", "SHORT", 2, 90, 20),
+				order(4, "SELL", "LONG", 1, 95, -5),
+			},
+			funding: []Income{funding(2, "-3")},
+			want: []wantRow{
+				{"SHORT", 2, 3, "2.000", 100, 90, 20, 0.2, -2},
+				{"LONG", 1, 4, "1.000", 100, 95, -5, 0.2, -1},
+			},
+		},
+		{
+			name: "close of a position opened before the window",
+			orders: []*OrderGroup{
+				order(5, "SELL", "BOTH", 2, 110, 20),
+			},
+			funding: []Income{funding(1, "-1.5")},
+			want:    []wantRow{{"BOTH", 5, 5, "2.000", 0, 110, 20, 0.1, -1.5}},
+		},
+		{
+			name: "position opened before the window, scaled into and closed",
+			orders: []*OrderGroup{
+				order(2, "BUY", "BOTH", 1, 120, 0),
+				order(3, "SELL", "BOTH", 3, 130, 40),
+			},
+			funding: []Income{funding(1, "-1")},
+			opening: map[string]float64{"BTCUSDT|BOTH": 2},
+			// 2 at 110 and 1 at 120 average to the entry the realized PnL implies
+			want: []wantRow{{"BOTH", 3, 3, "3.000", 130 - 40.0/3, 130, 40, 0.2, -1}},
+		},
+		{
+			name: "hedge short opened before the window",
+			orders: []*OrderGroup{
+				order(2, "BUY", "SHORT", 1, 90, 10),
+				order(3, "BUY", "LONG", 1, 90, 0),
+			},
+			opening: map[string]float64{"BTCUSDT|SHORT": -1},
+			want:    []wantRow{{"SHORT", 2, 2, "1.000", 100, 90, 10, 0.1, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reconstructPositions(tt.orders, tt.funding, tt.opening)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				row := got[i]
+				minute := time.Minute.Milliseconds()
+				if row.PositionSide != want.positionSide ||
+					row.OpenTime.UnixMilli() != want.open*minute ||
+					row.CloseTime.UnixMilli() != want.close*minute ||
+					row.Vol != want.vol {
+					t.Errorf("row %d: got %s %s -> %s vol %s, want %s minute %d -> %d vol %s", i,
+						row.PositionSide, row.OpenTime.UTC(), row.CloseTime.UTC(), row.Vol,
+						want.positionSide, want.open, want.close, want.vol)
+				}
+				checks := []struct {
+					field     string
+					got, want float64
+				}{
+					{"entry", row.AvgEntryPrice, want.entry},
+					{"exit", row.AvgExitPrice, want.exit},
+					{"pnl", row.GrossPnl, want.pnl},
+					{"fees", row.Fees, want.fees},
+					{"funding", row.Funding, want.funding},
+				}
+				for _, c := range checks {
+					if math.Abs(c.got-c.want) > 1e-9 {
+						t.Errorf("row %d: %s %v, want %v", i, c.field, c.got, c.want)
+					}
+				}
+				if net := strconv.FormatFloat(want.pnl-want.fees+want.funding, 'f', 2, 64); row.NetPnl != net {
+					t.Errorf("row %d: net %s, want %s", i, row.NetPnl, net)
+				}
+			}
+		})
+	}
+}
+
+func TestOpeningPositions(t *testing.T) {
+	orders := []*OrderGroup{
+		order(1, "BUY", "BOTH", 1, 120, 0),
+		order(2, "SELL", "BOTH", 3, 130, 40),
+		order(3, "SELL", "BOTH", 0.5, 125, 0),
+		order(4, "SELL", "SHORT", 1, 125, 0),
+	}
+	// Short 0.5 now in one-way mode and 1 in hedge, the one-way long of 2 predates the orders
+	got := openingPositions(map[string]float64{"BTCUSDT|BOTH": -0.5, "BTCUSDT|SHORT": -1}, orders)
+	if len(got) != 1 || math.Abs(got["BTCUSDT|BOTH"]-2) > qtyEpsilon {
+		t.Errorf("got %v, want BTCUSDT|BOTH 2", got)
+	}
+}
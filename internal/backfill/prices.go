@@ -0,0 +1,146 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	minuteMs          = 60 * 1000
+	klinePageLimit    = 1000
+	weightKlines1000  = 5
+	commissionUSDT    = "USDT"
+	fundingIncomeType = "FUNDING_FEE"
+)
+
+// priceCache keeps 1m close prices per symbol keyed by the minute open time (ms)
+type priceCache struct {
+	mu     sync.Mutex
+	closes map[string]map[int64]float64
+}
+
+func newPriceCache() *priceCache {
+	return &priceCache{closes: make(map[string]map[int64]float64)}
+}
+
+func (p *priceCache) get(symbol string, minute int64) (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	price, ok := p.closes[symbol][minute]
+	return price, ok
+}
+
+func (p *priceCache) put(symbol string, minute int64, price float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closes[symbol] == nil {
+		p.closes[symbol] = make(map[int64]float64)
+	}
+	p.closes[symbol][minute] = price
+}
+
+// usdtRate returns how many USDT one unit of asset was worth at timeMs,
+// using the 1m close of the <asset>USDT perpetual
+func (c *restClient) usdtRate(ctx context.Context, asset string, timeMs int64) (float64, error) {
+	if asset == commissionUSDT || asset == "" {
+		return 1, nil
+	}
+
+	symbol := asset + commissionUSDT
+	minute := timeMs - timeMs%minuteMs
+	if price, ok := c.prices.get(symbol, minute); ok {
+		return price, nil
+	}
+
+	// Pull the next 1000 minutes at once, trades tend to cluster
+	if err := c.fetchMinuteCloses(ctx, symbol, minute); err != nil {
+		return 0, err
+	}
+	if price, ok := c.prices.get(symbol, minute); ok {
+		return price, nil
+	}
+	return 0, fmt.Errorf("no %s price at %d", symbol, minute)
+}
+
+func (c *restClient) fetchMinuteCloses(ctx context.Context, symbol string, startTime int64) error {
+	if err := c.limiter.Wait(ctx, weightKlines1000); err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Add("symbol", symbol)
+	params.Add("interval", "1m")
+	params.Add("startTime", strconv.FormatInt(startTime, 10))
+	params.Add("limit", strconv.Itoa(klinePageLimit))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/fapi/v1/klines?%s", c.BaseURL, params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	resp, err := c.client.Do(req)
+	apiRequestDuration.Observe(time.Since(started).Seconds(), "/fapi/v1/klines")
+	if err != nil {
+		apiErrorsTotal.Inc("/fapi/v1/klines", "0")
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErrorsTotal.Inc("/fapi/v1/klines", strconv.Itoa(resp.StatusCode))
+		body, _ := io.ReadAll(resp.Body)
+		c.log.Warn("Binance API error",
+			"path", "/fapi/v1/klines",
+			"status", resp.StatusCode,
+			"body", string(body),
+		)
+		return fmt.Errorf("API Error %d on klines: %s", resp.StatusCode, string(body))
+	}
+
+	// Each kline is [openTime, open, high, low, close, ...]
+	var klines [][]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&klines); err != nil {
+		return err
+	}
+	for _, k := range klines {
+		if len(k) < 5 {
+			continue
+		}
+		var openTime int64
+		var closeStr string
+		if json.Unmarshal(k[0], &openTime) != nil || json.Unmarshal(k[4], &closeStr) != nil {
+			continue
+		}
+		closePrice, err := strconv.ParseFloat(closeStr, 64)
+		if err != nil {
+			continue
+		}
+		c.prices.put(symbol, openTime, closePrice)
+	}
+	return nil
+}
+
+// convertCommissions rewrites every fill's commission into USDT in place
+func (c *restClient) convertCommissions(ctx context.Context, trades []Trade) error {
+	for i := range trades {
+		t := &trades[i]
+		if t.CommissionAsset == commissionUSDT {
+			continue
+		}
+		rate, err := c.usdtRate(ctx, t.CommissionAsset, t.Time)
+		if err != nil {
+			return err
+		}
+		comm, _ := strconv.ParseFloat(t.Commission, 64)
+		t.Commission = strconv.FormatFloat(comm*rate, 'f', -1, 64)
+		t.CommissionAsset = commissionUSDT
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package backfill
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Request weights of the endpoints we call, see Binance USDⓈ-M Futures docs
+const (
+	weightUserTrades   = 5
+	weightIncome       = 30
+	weightPositionRisk = 5
+)
+
+// weightLimiter is a token bucket over Binance request weight. Workers fetching
+// different symbols share one limiter so together they stay below the IP limit.
+type weightLimiter struct {
+	mu           sync.Mutex
+	capacity     float64
+	tokens       float64
+	refillPerSec float64
+	last         time.Time
+}
+
+func newWeightLimiter(weightPerMinute int) *weightLimiter {
+	return &weightLimiter{
+		capacity:     float64(weightPerMinute),
+		tokens:       float64(weightPerMinute),
+		refillPerSec: float64(weightPerMinute) / 60,
+		last:         time.Now(),
+	}
+}
+
+// Wait blocks until weight can be spent or ctx is cancelled
+func (l *weightLimiter) Wait(ctx context.Context, weight int) error {
+	for {
+		l.mu.Lock()
+		l.refill()
+		if l.tokens >= float64(weight) {
+			l.tokens -= float64(weight)
+			l.mu.Unlock()
+			return nil
+		}
+		missing := float64(weight) - l.tokens
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(missing / l.refillPerSec * float64(time.Second))):
+		}
+	}
+}
+
+// Observe syncs with the X-MBX-USED-WEIGHT-1M header, other processes on the
+// same IP also spend weight so the server count wins when it is higher.
+func (l *weightLimiter) Observe(usedWeight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if remaining := l.capacity - float64(usedWeight); remaining < l.tokens {
+		l.tokens = max(remaining, 0)
+	}
+}
+
+func (l *weightLimiter) refill() {
+	now := time.Now()
+	l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.refillPerSec)
+	l.last = now
+}
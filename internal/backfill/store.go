@@ -0,0 +1,160 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/health"
+)
+
+// StorePositionHistory inserts every row, already stored positions are skipped
+// by the store. Every row's outcome is logged, inserted and skipped at debug.
+func StorePositionHistory(store db.PositionStore, history []PositionRow, log *slog.Logger) (inserted int, skipped int, failed int) {
+	for _, item := range history {
+		netPnl, _ := strconv.ParseFloat(item.NetPnl, 64)
+		volume, _ := strconv.ParseFloat(item.Vol, 64)
+
+		ok, err := store.InsertPositionHistory(db.PositionHistory{
+			Market:        item.Market,
+			Symbol:        item.Symbol,
+			Side:          item.Side,
+			PositionSide:  item.PositionSide,
+			GrossPnl:      item.GrossPnl,
+			Fees:          item.Fees,
+			Funding:       item.Funding,
+			NetPnl:        netPnl,
+			Volume:        volume,
+			AvgEntryPrice: item.AvgEntryPrice,
+			AvgExitPrice:  item.AvgExitPrice,
+			OpenTime:      item.OpenTime,
+			CloseTime:     item.CloseTime,
+		})
+		row := []any{
+			"symbol", item.Symbol,
+			"side", item.Side,
+			"position_side", item.PositionSide,
+			"close_time", item.CloseTime.UTC(),
+			"net_pnl", netPnl,
+		}
+		if err != nil {
+			failed++
+			rowsTotal.Inc("failed")
+			log.Error("Position insert failed", append(row, "outcome", "failed", "error", err)...)
+			continue
+		}
+		if !ok {
+			skipped++
+			rowsTotal.Inc("skipped")
+			log.Debug("Position already stored", append(row, "outcome", "skipped")...)
+			continue
+		}
+		inserted++
+		rowsTotal.Inc("inserted")
+		log.Debug("Position inserted", append(row, "outcome", "inserted")...)
+	}
+	return inserted, skipped, failed
+}
+
+// Store keeps the positions and tells which user stream outages still need a backfill
+type Store interface {
+	db.PositionStore
+	db.StreamGapStore
+}
+
+// RunJob fetches the position history of the last hoursBack hours, reaching
+// back to the oldest user stream gap not repaired yet, and stores it. Closed
+// gaps are marked repaired after a clean run, open ones are covered up to now
+// and stay until the stream is back.
+// When ctx is cancelled mid-run the rows fetched so far are still inserted, so
+// a shutdown acts as a checkpoint and the next run only repeats the rest.
+// When table is not nil the fetched positions are also printed to it.
+func RunJob(ctx context.Context, config *config.AppConfig, store Store, hoursBack int, symbols []string, table io.Writer, log *slog.Logger) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	started := time.Now()
+	from := backfillStart(store, started, hoursBack, log)
+	log.Info("Backfill Position History started", "lookback_hours", hoursBack, "from", from.UTC(), "symbols", symbols)
+
+	status := health.Register("backfill", false, 0)
+	status.Set("last_run_at", started)
+
+	var fetched, inserted, skipped, failed int
+	defer func() {
+		duration := time.Since(started)
+		runDuration.Observe(duration.Seconds())
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+			runsTotal.Inc("error")
+			status.Failure(err)
+		} else {
+			runsTotal.Inc("success")
+			status.Success()
+		}
+		status.Set("last_run_outcome", outcome)
+
+		summary := []any{
+			"outcome", outcome,
+			"fetched", fetched,
+			"inserted", inserted,
+			"skipped", skipped,
+			"failed", failed,
+			"duration_ms", duration.Milliseconds(),
+		}
+		if err != nil {
+			log.Error("Backfill Position History finished", append(summary, "error", err)...)
+		} else {
+			log.Info("Backfill Position History finished", summary...)
+		}
+	}()
+
+	history, fetchErr := GetPositionHistory(ctx, config, from, started, symbols, log)
+	fetched = len(history)
+	if table != nil {
+		if err := WriteTable(table, history); err != nil {
+			log.Warn("Could not print position table", "error", err)
+		}
+	}
+
+	inserted, skipped, failed = StorePositionHistory(store, history, log)
+	status.Set("last_run_rows", map[string]int{"inserted": inserted, "skipped": skipped, "failed": failed})
+
+	if fetchErr != nil {
+		return fetchErr
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d positions failed to insert", failed)
+	}
+
+	// Only a run that stored everything repairs the gaps it covered
+	if err := store.MarkStreamGapsRepaired(started); err != nil {
+		log.Warn("Could not mark stream gaps repaired", "error", err)
+	}
+	return nil
+}
+
+// backfillStart is the start of the lookback window, moved back to the oldest
+// unrepaired stream gap. Without the gaps the lookback alone is used.
+func backfillStart(store db.StreamGapStore, now time.Time, hoursBack int, log *slog.Logger) time.Time {
+	from := now.Add(-time.Duration(hoursBack) * time.Hour)
+
+	gaps, err := store.UnrepairedStreamGaps()
+	if err != nil {
+		log.Warn("Could not read stream gaps, using the lookback only", "error", err)
+		return from
+	}
+	for _, gap := range gaps {
+		log.Info("Repairing stream gap", "gap_start", gap.From.UTC(), "gap_end", gap.To.UTC(), "open", gap.To.IsZero(), "reason", gap.Reason)
+		if gap.From.Before(from) {
+			from = gap.From
+		}
+	}
+	return from
+}
@@ -0,0 +1,132 @@
+package backfill
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/db"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestBackfillStart(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		gaps []db.StreamGap
+		err  error
+		want time.Time
+	}{
+		{"lookback only", nil, nil, now.Add(-2 * time.Hour)},
+		{
+			name: "closed gap inside the lookback",
+			gaps: []db.StreamGap{{From: now.Add(-time.Hour), To: now.Add(-30 * time.Minute)}},
+			want: now.Add(-2 * time.Hour),
+		},
+		{
+			name: "closed gap before the lookback",
+			gaps: []db.StreamGap{{From: now.Add(-30 * time.Hour), To: now.Add(-29 * time.Hour)}},
+			want: now.Add(-30 * time.Hour),
+		},
+		{
+			name: "open gap left by a stopped process",
+			gaps: []db.StreamGap{
+				{From: now.Add(-5 * time.Hour), To: now.Add(-4 * time.Hour)},
+				{From: now.Add(-72 * time.Hour)},
+			},
+			want: now.Add(-72 * time.Hour),
+		},
+		{"unreadable gaps", nil, errors.New("connection refused"), now.Add(-2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := db.NewMemoryStore()
+			store.Gaps = tt.gaps
+			store.Err = tt.err
+			if got := backfillStart(store, now, 2, discard); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamGapLifecycle(t *testing.T) {
+	store := db.NewMemoryStore()
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Disconnected, the process stops and a new one reconnects later
+	store.OpenStreamGap(start, "dial: connection reset")
+	store.OpenStreamGap(start, "duplicate report")
+	if gaps, _ := store.UnrepairedStreamGaps(); len(gaps) != 1 || !gaps[0].To.IsZero() {
+		t.Fatalf("got gaps %+v, want one open gap", gaps)
+	}
+
+	// A backfill while the gap is open covers it but can't repair it yet
+	store.MarkStreamGapsRepaired(start.Add(time.Hour))
+	if len(store.Gaps) != 1 {
+		t.Fatalf("open gap was marked repaired")
+	}
+
+	store.CloseStreamGaps(start.Add(2 * time.Hour))
+	store.MarkStreamGapsRepaired(start.Add(time.Hour))
+	if len(store.Gaps) != 1 {
+		t.Fatalf("gap repaired by a backfill that started before it ended")
+	}
+	store.MarkStreamGapsRepaired(start.Add(3 * time.Hour))
+	if len(store.Gaps) != 0 || len(store.Repaired) != 1 {
+		t.Fatalf("got %d unrepaired and %d repaired gaps, want 0 and 1", len(store.Gaps), len(store.Repaired))
+	}
+}
+
+func TestStorePositionHistory(t *testing.T) {
+	open := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	row := func(symbol string, positionSide string, openTime time.Time, netPnl string) PositionRow {
+		return PositionRow{
+			Market:       MarketBinanceUSDM,
+			Symbol:       symbol,
+			Side:         "SELL",
+			PositionSide: positionSide,
+			GrossPnl:     12.5,
+			Fees:         0.5,
+			NetPnl:       netPnl,
+			Vol:          "0.010",
+			OpenTime:     openTime,
+			CloseTime:    openTime.Add(time.Hour),
+		}
+	}
+	history := []PositionRow{
+		row("BTCUSDT", "BOTH", open, "12.00"),
+		row("ETHUSDT", "BOTH", open, "-3.25"),
+		row("BTCUSDT", "BOTH", open.Add(2*time.Hour), "1.00"),
+		// Hedge mode opens a long and a short in the same millisecond
+		row("SOLUSDT", "LONG", open, "4.00"),
+		row("SOLUSDT", "SHORT", open, "-1.00"),
+	}
+
+	store := db.NewMemoryStore()
+	inserted, skipped, failed := StorePositionHistory(store, history, discard)
+	if inserted != 5 || skipped != 0 || failed != 0 {
+		t.Fatalf("first run: %d inserted, %d skipped, %d failed", inserted, skipped, failed)
+	}
+	if got := store.Positions[1]; got.Symbol != "ETHUSDT" || got.PositionSide != "BOTH" || got.NetPnl != -3.25 || got.Volume != 0.01 {
+		t.Errorf("stored %+v", got)
+	}
+	if got := store.Positions[4]; got.Symbol != "SOLUSDT" || got.PositionSide != "SHORT" || got.NetPnl != -1 {
+		t.Errorf("stored %+v", got)
+	}
+
+	// An overlapping window finds the same positions again
+	inserted, skipped, failed = StorePositionHistory(store, append(history, row("XRPUSDT", "BOTH", open, "2.00")), discard)
+	if inserted != 1 || skipped != 5 || failed != 0 {
+		t.Errorf("second run: %d inserted, %d skipped, %d failed", inserted, skipped, failed)
+	}
+
+	store.Err = errors.New("connection refused")
+	inserted, skipped, failed = StorePositionHistory(store, history, discard)
+	if inserted != 0 || skipped != 0 || failed != 5 {
+		t.Errorf("outage: %d inserted, %d skipped, %d failed", inserted, skipped, failed)
+	}
+}
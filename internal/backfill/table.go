@@ -0,0 +1,29 @@
+package backfill
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTable prints the positions newest first for a human at the terminal,
+// logs carry the same data as structured events
+func WriteTable(w io.Writer, history []PositionRow) error {
+	rule := strings.Repeat("-", 89)
+	lines := []string{
+		rule,
+		fmt.Sprintf("%-10s | %-6s | %-12s | %-10s | %-20s | %-20s",
+			"Symbol", "Side", "Net PnL", "Vol", "Opened Time", "Closed Time"),
+		rule,
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		lines = append(lines, fmt.Sprintf("%-10s | %-6s | %-12s | %-10s | %-20s | %-20s",
+			h.Symbol, h.Side, h.NetPnl, h.Vol,
+			h.OpenTime.Format("2006-01-02 15:04:05"), h.CloseTime.Format("2006-01-02 15:04:05")))
+	}
+	lines = append(lines, rule)
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
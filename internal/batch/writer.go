@@ -0,0 +1,357 @@
+// Package batch buffers records in front of the database. Records are written
+// in batches, and while the database is unreachable they are appended to a
+// local spool file which is replayed in order once writes succeed again.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"vector-quant-monitor/internal/metrics"
+	"vector-quant-monitor/util"
+)
+
+var (
+	writtenTotal = metrics.NewCounter(
+		"vqm_batch_records_written_total",
+		"Records written to the database, by writer.",
+		"writer",
+	)
+	writeErrorsTotal = metrics.NewCounter(
+		"vqm_batch_write_errors_total",
+		"Failed batch writes, by writer.",
+		"writer",
+	)
+	spooledTotal = metrics.NewCounter(
+		"vqm_batch_records_spooled_total",
+		"Records appended to the local spool, by writer.",
+		"writer",
+	)
+	droppedTotal = metrics.NewCounter(
+		"vqm_batch_records_dropped_total",
+		"Records lost because the queue or the spool was full, by writer.",
+		"writer",
+	)
+	spoolBytes = metrics.NewGauge(
+		"vqm_batch_spool_bytes",
+		"Size of the spool file waiting for replay, by writer.",
+		"writer",
+	)
+)
+
+// Writer batches records of type T, T must survive a JSON round trip
+type Writer[T any] struct {
+	Name          string
+	BatchSize     int           // Flush as soon as this many records are queued
+	FlushInterval time.Duration // Flush at least this often
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+	SpoolPath     string // Spooling is disabled when empty, failed batches are dropped
+	MaxSpoolBytes int64
+
+	write func(batch []T) error
+	queue chan T
+	log   *slog.Logger
+
+	mu      sync.Mutex
+	failure error // Last flush error, nil once a write succeeds
+}
+
+func NewWriter[T any](name string, spoolDir string, write func(batch []T) error, log *slog.Logger) *Writer[T] {
+	w := &Writer[T]{
+		Name:          name,
+		BatchSize:     100,
+		FlushInterval: 10 * time.Second,
+		MinBackoff:    time.Second,
+		MaxBackoff:    5 * time.Minute,
+		MaxSpoolBytes: 256 << 20,
+		write:         write,
+		queue:         make(chan T, 10000),
+		log:           log,
+	}
+	if spoolDir != "" {
+		w.SpoolPath = filepath.Join(spoolDir, name+".jsonl")
+	}
+	return w
+}
+
+// Add queues a record without blocking, the record is dropped when the queue is full
+func (w *Writer[T]) Add(record T) {
+	select {
+	case w.queue <- record:
+	default:
+		droppedTotal.Inc(w.Name)
+		w.setErr(fmt.Errorf("%s: queue full, record dropped", w.Name))
+	}
+}
+
+// Err returns why the last flush failed, records are being spooled or
+// dropped until it is nil again. Add never fails, callers report this instead.
+func (w *Writer[T]) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failure
+}
+
+func (w *Writer[T]) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failure = err
+}
+
+// Run flushes the queue until ctx is cancelled. On shutdown the queued
+// records get one write attempt and go to the spool if it fails.
+func (w *Writer[T]) Run(ctx context.Context) error {
+	if w.SpoolPath != "" {
+		if err := os.MkdirAll(filepath.Dir(w.SpoolPath), 0o755); err != nil {
+			w.log.Info(fmt.Sprintf("%s: spooling disabled, could not create spool directory: %v", w.Name, err))
+			w.SpoolPath = ""
+		} else if size := w.spoolSize(); size > 0 {
+			w.log.Info(fmt.Sprintf("%s: %d bytes spooled by a previous run, replaying", w.Name, size))
+		}
+	}
+
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
+
+	var pending []T
+	var retryAt time.Time
+	attempt := 0
+
+	for {
+		flush := false
+		select {
+		case <-ctx.Done():
+			pending = w.drain(pending)
+			w.shutdown(pending, !retryAt.IsZero())
+			return nil
+		case record := <-w.queue:
+			pending = append(pending, record)
+			flush = len(pending) >= w.BatchSize
+		case <-ticker.C:
+			flush = true
+		}
+		if !flush {
+			continue
+		}
+
+		// 1. While backing off new records join the spool so the order is kept
+		if time.Now().Before(retryAt) {
+			pending = w.spool(pending)
+			continue
+		}
+
+		// 2. Older spooled records go first
+		err := w.replay()
+		if err == nil && len(pending) > 0 {
+			if err = w.write(pending); err == nil {
+				writtenTotal.Add(float64(len(pending)), w.Name)
+				pending = nil
+			}
+		}
+
+		if err != nil {
+			writeErrorsTotal.Inc(w.Name)
+			wait := util.Backoff(attempt, w.MinBackoff, w.MaxBackoff)
+			attempt++
+			retryAt = time.Now().Add(wait)
+			w.log.Info(fmt.Sprintf("%s: write failed (attempt %d), retrying in %s: %v", w.Name, attempt, wait, err))
+			w.setErr(fmt.Errorf("%s: write failed, records spooled: %w", w.Name, err))
+			pending = w.spool(pending)
+			continue
+		}
+		if attempt > 0 {
+			w.log.Info(fmt.Sprintf("%s: writes recovered after %d attempts", w.Name, attempt))
+		}
+		attempt = 0
+		retryAt = time.Time{}
+		w.setErr(nil)
+	}
+}
+
+// drain takes whatever is still queued
+func (w *Writer[T]) drain(pending []T) []T {
+	for {
+		select {
+		case record := <-w.queue:
+			pending = append(pending, record)
+		default:
+			return pending
+		}
+	}
+}
+
+// shutdown skips the write attempt when the database is known to be down, it could hang past the shutdown deadline
+func (w *Writer[T]) shutdown(pending []T, failing bool) {
+	if len(pending) == 0 {
+		return
+	}
+	if !failing && w.spoolSize() == 0 {
+		if err := w.write(pending); err == nil {
+			writtenTotal.Add(float64(len(pending)), w.Name)
+			return
+		}
+	}
+	w.spool(pending)
+	w.log.Info(fmt.Sprintf("%s: %d records spooled for the next run", w.Name, len(pending)))
+}
+
+// spool appends records to the spool file and returns what could not be kept
+func (w *Writer[T]) spool(records []T) []T {
+	if len(records) == 0 {
+		return nil
+	}
+	if w.SpoolPath == "" {
+		droppedTotal.Add(float64(len(records)), w.Name)
+		return nil
+	}
+	if w.spoolSize() >= w.MaxSpoolBytes {
+		droppedTotal.Add(float64(len(records)), w.Name)
+		w.log.Info(fmt.Sprintf("%s: spool is full, dropping %d records", w.Name, len(records)))
+		return nil
+	}
+
+	f, err := os.OpenFile(w.SpoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		// Keep them in memory and try again on the next flush
+		w.log.Info(fmt.Sprintf("%s: could not open spool: %v", w.Name, err))
+		return records
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	enc := json.NewEncoder(buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			droppedTotal.Inc(w.Name)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		w.log.Info(fmt.Sprintf("%s: could not write spool: %v", w.Name, err))
+		return records
+	}
+	f.Sync()
+
+	spooledTotal.Add(float64(len(records)), w.Name)
+	spoolBytes.Set(float64(w.spoolSize()), w.Name)
+	return nil
+}
+
+// replay writes the spool in BatchSize chunks. On failure the written
+// chunks are cut from the file so they aren't written twice.
+func (w *Writer[T]) replay() error {
+	if w.spoolSize() == 0 {
+		return nil
+	}
+	f, err := os.Open(w.SpoolPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64 // Bytes of the file already in the database
+	var chunk []T
+	var chunkBytes int64
+	replayed := 0
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			chunkBytes += int64(len(line))
+			var record T
+			if err := json.Unmarshal(line, &record); err != nil {
+				// A torn last line from a crash, nothing to recover
+				droppedTotal.Inc(w.Name)
+			} else {
+				chunk = append(chunk, record)
+			}
+		}
+
+		end := errors.Is(readErr, io.EOF)
+		if readErr != nil && !end {
+			return readErr
+		}
+		if len(chunk) >= w.BatchSize || (end && len(chunk) > 0) {
+			if err := w.write(chunk); err != nil {
+				f.Close()
+				if cutErr := w.cutSpool(offset); cutErr != nil {
+					w.log.Info(fmt.Sprintf("%s: could not trim spool: %v", w.Name, cutErr))
+				}
+				return err
+			}
+			writtenTotal.Add(float64(len(chunk)), w.Name)
+			replayed += len(chunk)
+			offset += chunkBytes
+			chunk, chunkBytes = nil, 0
+		}
+		if end {
+			break
+		}
+	}
+
+	f.Close()
+	if err := os.Remove(w.SpoolPath); err != nil {
+		return err
+	}
+	spoolBytes.Set(0, w.Name)
+	w.log.Info(fmt.Sprintf("%s: replayed %d spooled records", w.Name, replayed))
+	return nil
+}
+
+// cutSpool drops the first offset bytes by rewriting the rest to a new file
+func (w *Writer[T]) cutSpool(offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+	src, err := os.Open(w.SpoolPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp := w.SpoolPath + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.SpoolPath); err != nil {
+		return err
+	}
+	spoolBytes.Set(float64(w.spoolSize()), w.Name)
+	return nil
+}
+
+func (w *Writer[T]) spoolSize() int64 {
+	if w.SpoolPath == "" {
+		return 0
+	}
+	info, err := os.Stat(w.SpoolPath)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,92 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDB records the batches it accepted and fails while down is set
+type flakyDB struct {
+	mu      sync.Mutex
+	down    bool
+	written []int
+}
+
+func (f *flakyDB) write(batch []int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("connection refused")
+	}
+	f.written = append(f.written, batch...)
+	return nil
+}
+
+func (f *flakyDB) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *flakyDB) rows() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.written)
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWriterSpoolsAndReportsOutage(t *testing.T) {
+	db := &flakyDB{}
+	w := NewWriter("test", t.TempDir(), db.write, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	w.BatchSize = 2
+	w.FlushInterval = 10 * time.Millisecond
+	w.MinBackoff = time.Millisecond
+	w.MaxBackoff = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	w.Add(1)
+	w.Add(2)
+	eventually(t, "the first batch", func() bool { return len(db.rows()) == 2 })
+	if err := w.Err(); err != nil {
+		t.Errorf("healthy writer reports %v", err)
+	}
+
+	db.setDown(true)
+	w.Add(3)
+	w.Add(4)
+	eventually(t, "the outage to be reported", func() bool { return w.Err() != nil })
+	w.Add(5)
+
+	db.setDown(false)
+	w.Add(6)
+	eventually(t, "the spool to be replayed", func() bool { return len(db.rows()) == 6 })
+	eventually(t, "the recovery to be reported", func() bool { return w.Err() == nil })
+
+	cancel()
+	<-done
+	if got := db.rows(); !slices.Equal(got, []int{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("written %v, want every record once and in order", got)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -16,12 +18,51 @@ type AppConfig struct {
 	Database DatabaseConfig
 	Worker   WorkerConfig
 	Binance  BinanceMarketConfig
+	Notifier NotifierConfig
+	Alert    AlertConfig
+	Backfill BackfillConfig
+	Migrate  MigrateConfig
+	HTTP     HTTPConfig
+	Host     HostConfig
+}
+
+type HostConfig struct {
+	Name         string            // Overrides the discovered resource name of every metric row
+	Labels       map[string]string // e.g. environment=prod,role=bot, stored with every metric row
+	IMDSEndpoint string            // EC2 instance metadata service, discovery is skipped when empty
+}
+
+type HTTPConfig struct {
+	Addr string // Listen address of /metrics, /healthz, /readyz and /loglevel, e.g. ":9100", disabled when empty
+	// PUT/POST /loglevel change levels, off by default as the listener has no authentication
+	LogLevelChanges bool
+}
+
+type MigrateConfig struct {
+	EmbeddingDim int // Dimension of market_pattern_go.embedding when the table has to be created
+}
+
+type BackfillConfig struct {
+	Symbols         []string // Empty means discover from the income history
+	Concurrency     int
+	WeightPerMinute int // Budget out of Binance's 2400/min IP limit
+}
+
+type AlertConfig struct {
+	RulesFile string // JSON array of alert.Rule, built-in defaults when empty
+}
+
+type NotifierConfig struct {
+	DiscordWebhookURL string
+	DiscordUsername   string
 }
 
 type BinanceMarketConfig struct {
 	ApiKey    string
 	ApiSecret string
 	Leverage  int
+	TakerFee  float64 // Fraction of the notional, 0.0005 is 0.05%
+	MakerFee  float64
 }
 
 type AwsSecretData struct {
@@ -30,10 +71,19 @@ type AwsSecretData struct {
 	BinanceApiKey                      string `json:"BINANCE_API_KEY"`
 	BinanceApiSecret                   string `json:"BINANCE_SECRET_KEY"`
 	OPENAI_API_KEY                     string `json:"OPENAI_API_KEY"`
+	DiscordWebhookURL                  string `json:"DISCORD_WEBHOOK_URL"`
 }
 
 type WorkerConfig struct {
 	HostMetricIntervalSeconds int
+	HostTopProcesses          int    // Processes stored per sample, top N by CPU plus top N by RSS
+	CgroupRoot                string // cgroup v2 mount searched for containers, disabled when empty
+	DockerSocket              string // Docker Engine API used to name containers
+	ShutdownTimeoutSeconds    int    // Time allowed to finish in-flight work after SIGINT/SIGTERM
+
+	MetricBatchSize            int    // Samples per insert
+	MetricFlushIntervalSeconds int    // Longest a sample waits for its batch
+	MetricSpoolDir             string // Samples wait here while Postgres is down, disabled when empty
 }
 
 type DatabaseConfig struct {
@@ -45,8 +95,15 @@ type DatabaseConfig struct {
 }
 
 func LoadConfig() *AppConfig {
+	cfg := LoadEnvConfig()
+	ApplyAwsSecrets(cfg)
+	return cfg
+}
+
+// LoadEnvConfig reads environment variables only, it never calls AWS
+func LoadEnvConfig() *AppConfig {
 	// 1. Initialize the base config with Env vars (fallbacks or non-secret values)
-	cfg := &AppConfig{
+	return &AppConfig{
 		Database: DatabaseConfig{
 			DBHost:     getEnv("DB_HOST", ""),
 			DBPort:     getEnvAsInt("DB_PORT", 5432),
@@ -56,14 +113,51 @@ func LoadConfig() *AppConfig {
 		},
 		Worker: WorkerConfig{
 			HostMetricIntervalSeconds: getEnvAsInt("WORKER_HOST_METRIC_INTERVAL_SECONDS", 10),
+			HostTopProcesses:          getEnvAsInt("HOST_TOP_PROCESSES", 10),
+			CgroupRoot:                getEnv("CGROUP_ROOT", "/sys/fs/cgroup"),
+			DockerSocket:              getEnv("DOCKER_SOCKET", "/var/run/docker.sock"),
+			ShutdownTimeoutSeconds:    getEnvAsInt("SHUTDOWN_TIMEOUT_SECONDS", 8), // Docker kills after 10s
+
+			MetricBatchSize:            getEnvAsInt("METRIC_BATCH_SIZE", 100),
+			MetricFlushIntervalSeconds: getEnvAsInt("METRIC_FLUSH_INTERVAL_SECONDS", 10),
+			MetricSpoolDir:             getEnv("METRIC_SPOOL_DIR", filepath.Join(os.TempDir(), "vqm-spool")),
 		},
 		Binance: BinanceMarketConfig{
 			ApiKey:    getEnv("BINANCE_API_KEY", ""),    // Will be overwritten
 			ApiSecret: getEnv("BINANCE_SECRET_KEY", ""), // Will be overwritten
 			Leverage:  getEnvAsInt("LEVERAGE", 20),
+			TakerFee:  getEnvAsFloat("BINANCE_TAKER_FEE", 0.0005),
+			MakerFee:  getEnvAsFloat("BINANCE_MAKER_FEE", 0.0002),
+		},
+		Notifier: NotifierConfig{
+			DiscordWebhookURL: getEnv("DISCORD_WEBHOOK_URL", ""), // Will be overwritten
+			DiscordUsername:   getEnv("DISCORD_USERNAME", "vector-quant-monitor"),
+		},
+		Alert: AlertConfig{
+			RulesFile: getEnv("ALERT_RULES_FILE", ""),
+		},
+		Backfill: BackfillConfig{
+			Symbols:         getEnvAsList("BACKFILL_SYMBOLS"),
+			Concurrency:     getEnvAsInt("BACKFILL_CONCURRENCY", 4),
+			WeightPerMinute: getEnvAsPositiveInt("BINANCE_WEIGHT_PER_MINUTE", 1200),
+		},
+		Migrate: MigrateConfig{
+			EmbeddingDim: getEnvAsInt("EMBEDDING_DIM", 0),
+		},
+		HTTP: HTTPConfig{
+			Addr:            getEnv("HTTP_ADDR", ""),
+			LogLevelChanges: getEnvAsBool("HTTP_LOGLEVEL_CHANGES", false),
+		},
+		Host: HostConfig{
+			Name:         getEnv("HOST_NAME", ""),
+			Labels:       getEnvAsMap("HOST_LABELS"),
+			IMDSEndpoint: getEnv("IMDS_ENDPOINT", ""), // Opt-in, off EC2 every start would wait for the timeout
 		},
 	}
+}
 
+// ApplyAwsSecrets overwrites sensitive fields with the secret named by AWS_SECRET_NAME
+func ApplyAwsSecrets(cfg *AppConfig) {
 	// 2. Fetch Secrets from AWS to overwrite sensitive fields
 	secretName := os.Getenv("AWS_SECRET_NAME")
 	if secretName != "" {
@@ -82,11 +176,12 @@ func LoadConfig() *AppConfig {
 		if secrets.BinanceApiSecret != "" {
 			cfg.Binance.ApiSecret = secrets.BinanceApiSecret
 		}
+		if secrets.DiscordWebhookURL != "" {
+			cfg.Notifier.DiscordWebhookURL = secrets.DiscordWebhookURL
+		}
 	} else {
 		log.Println("Warning: AWS_SECRET_NAME not set. Using environment variables only.")
 	}
-
-	return cfg
 }
 
 func fetchAwsSecrets(secretName string) AwsSecretData {
@@ -136,3 +231,54 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// getEnvAsPositiveInt falls back for values <= 0, e.g. a zero rate that would never refill
+func getEnvAsPositiveInt(key string, fallback int) int {
+	if value := getEnvAsInt(key, fallback); value > 0 {
+		return value
+	}
+	return fallback
+}
+
+func getEnvAsFloat(key string, fallback float64) float64 {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+			return value
+		}
+	}
+	return fallback
+}
+
+// getEnvAsBool accepts the values of strconv.ParseBool, e.g. true, 1 or false
+func getEnvAsBool(key string, fallback bool) bool {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+	}
+	return fallback
+}
+
+// getEnvAsList splits a comma separated value, skipping empty items
+func getEnvAsList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsMap parses comma separated key=value pairs, items without "=" are skipped
+func getEnvAsMap(key string) map[string]string {
+	items := make(map[string]string)
+	for _, item := range getEnvAsList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		items[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return items
+}
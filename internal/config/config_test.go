@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestWeightPerMinute(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"2000", 2000},
+		{"0", 1200},
+		{"-5", 1200},
+		{"abc", 1200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("BINANCE_WEIGHT_PER_MINUTE", tt.value)
+			if got := LoadEnvConfig().Backfill.WeightPerMinute; got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogLevelChanges(t *testing.T) {
+	if LoadEnvConfig().HTTP.LogLevelChanges {
+		t.Error("log level changes allowed by default")
+	}
+	for value, want := range map[string]bool{"true": true, "1": true, "false": false, "yes": false} {
+		t.Setenv("HTTP_LOGLEVEL_CHANGES", value)
+		if got := LoadEnvConfig().HTTP.LogLevelChanges; got != want {
+			t.Errorf("%q: got %v, want %v", value, got, want)
+		}
+	}
+}
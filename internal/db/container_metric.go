@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ContainerMetric is one sample of a container's cgroup
+type ContainerMetric struct {
+	RecordedAt          time.Time
+	ContainerID         string
+	ContainerName       string
+	CpuPercent          float64 // 100 is one full core
+	CpuThrottledPercent float64 // Share of the interval the container was throttled
+	MemBytes            uint64
+	MemLimitBytes       uint64 // 0 when unlimited
+	MemPercent          float64
+	IOReadBytesPerSec   float64
+	IOWriteBytesPerSec  float64
+	Pids                int
+	PidsLimit           int // 0 when unlimited
+}
+
+// ContainerRecord is one collection of every container on a host, the unit of a batch
+type ContainerRecord struct {
+	Host    Host
+	Metrics []ContainerMetric
+}
+
+func (p *Postgresql) InsertContainerMetrics(host Host, metrics []ContainerMetric) error {
+	return p.InsertContainerRecords([]ContainerRecord{{Host: host, Metrics: metrics}})
+}
+
+// InsertContainerRecords writes the records in one transaction, a failed
+// batch leaves nothing behind and can be retried without duplicates
+func (p *Postgresql) InsertContainerRecords(records []ContainerRecord) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range records {
+		if err := insertContainerMetrics(tx, r.Host, r.Metrics); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insertContainerMetrics(tx *sql.Tx, host Host, metrics []ContainerMetric) error {
+	labels, err := host.labelsJSON()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO container_metric (
+			recorded_at
+			, resource
+			, container_id
+			, container_name
+			, cpu_pct
+			, cpu_throttled_pct
+			, mem_bytes
+			, mem_limit_bytes
+			, mem_pct
+			, io_read_bytes_per_sec
+			, io_write_bytes_per_sec
+			, pids
+			, pids_limit
+			, labels
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+	for _, m := range metrics {
+		_, err := tx.Exec(query,
+			m.RecordedAt, host.Resource, m.ContainerID, m.ContainerName,
+			m.CpuPercent, m.CpuThrottledPercent,
+			int64(m.MemBytes), nullIfZero(int64(m.MemLimitBytes)), m.MemPercent,
+			m.IOReadBytesPerSec, m.IOWriteBytesPerSec,
+			m.Pids, nullIfZero(int64(m.PidsLimit)), labels,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func nullIfZero(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
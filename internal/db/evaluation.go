@@ -0,0 +1,236 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// EvaluationRun is one row of evaluation_run, Params is stored as JSON. The
+// run's own figures are the ones of the first predictor.
+type EvaluationRun struct {
+	Kind       string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Symbol     string
+	Interval   string
+	RangeFrom  time.Time
+	RangeTo    time.Time
+	Params     any
+	QueryRows  int
+	Predictors []EvaluationPredictorResult
+}
+
+// EvaluationPredictorResult is one row of evaluation_run_predictor, Summary is stored as JSON
+type EvaluationPredictorResult struct {
+	Predictor   string
+	Predictions int
+	HitRate     float64 // NaN without predictions
+	Coverage    float64
+	Summary     any
+}
+
+// EvaluationPrediction is one query row of a run for one predictor, directions are 1, -1 or 0 when it abstained
+type EvaluationPrediction struct {
+	Predictor     string
+	Time          time.Time
+	Predicted     int
+	Actual        int
+	PositiveCount int
+	NegativeCount int
+	NumDiffCount  int
+	Neighbors     int
+	Score         float64
+	NextReturn    float64
+}
+
+// Rows per INSERT of predictions and equity points, Postgres allows at most 65535 parameters per statement
+const evaluationInsertBatch = 1000
+
+// InsertEvaluationRun stores the run and its predictions in one transaction and returns the run id
+func (p *Postgresql) InsertEvaluationRun(run EvaluationRun, predictions []EvaluationPrediction) (int64, error) {
+	if len(run.Predictors) == 0 {
+		return 0, fmt.Errorf("evaluation run without predictors")
+	}
+	params, err := json.Marshal(run.Params)
+	if err != nil {
+		return 0, err
+	}
+	summaries := make([]string, len(run.Predictors))
+	for i, r := range run.Predictors {
+		raw, err := json.Marshal(r.Summary)
+		if err != nil {
+			return 0, err
+		}
+		summaries[i] = string(raw)
+	}
+	primary := run.Predictors[0]
+
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO evaluation_run (
+			kind
+			, started_at
+			, finished_at
+			, symbol
+			, interval
+			, range_from
+			, range_to
+			, params
+			, query_rows
+			, predictions
+			, hit_rate
+			, coverage
+			, summary
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`, run.Kind, run.StartedAt, run.FinishedAt, run.Symbol, run.Interval, run.RangeFrom, run.RangeTo,
+		string(params), run.QueryRows, primary.Predictions, nullIfNaN(primary.HitRate), primary.Coverage, summaries[0],
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, r := range run.Predictors {
+		_, err := tx.Exec(`
+			INSERT INTO evaluation_run_predictor (run_id, predictor, predictions, hit_rate, coverage, summary)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, id, r.Predictor, r.Predictions, nullIfNaN(r.HitRate), r.Coverage, summaries[i])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	const columns = 11
+	for start := 0; start < len(predictions); start += evaluationInsertBatch {
+		batch := predictions[start:min(start+evaluationInsertBatch, len(predictions))]
+		placeholders := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*columns)
+		for i, e := range batch {
+			n := i * columns
+			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11))
+			args = append(args, id, e.Predictor, e.Time, e.Predicted, e.Actual,
+				e.PositiveCount, e.NegativeCount, e.NumDiffCount, e.Neighbors, e.Score, e.NextReturn)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO evaluation_prediction (
+				run_id
+				, predictor
+				, time
+				, predicted
+				, actual
+				, positive_count
+				, negative_count
+				, num_diff_count
+				, neighbors
+				, score
+				, next_return
+			)
+			VALUES `+strings.Join(placeholders, ", "), args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+func nullIfNaN(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// EvaluationPnl is one row of evaluation_pnl, a simulated trading of a run's predictions
+type EvaluationPnl struct {
+	RunID         int64
+	Predictor     string
+	Leverage      float64
+	FeeRate       float64
+	Slippage      float64
+	MinNumDiff    int
+	Trades        int
+	WinningTrades int
+	FinalEquity   float64
+	MaxDrawdown   float64
+	Sharpe        float64 // NaN without variance
+	Sortino       float64
+	Fees          float64
+}
+
+// EquityPoint is one row of evaluation_equity
+type EquityPoint struct {
+	Time         time.Time
+	Position     int
+	PeriodReturn float64
+	Equity       float64
+	Drawdown     float64
+}
+
+// InsertEvaluationPnl stores the simulation with its equity curve in one transaction and returns its id
+func (p *Postgresql) InsertEvaluationPnl(pnl EvaluationPnl, curve []EquityPoint) (int64, error) {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO evaluation_pnl (
+			run_id
+			, predictor
+			, leverage
+			, fee_rate
+			, slippage
+			, min_num_diff
+			, trades
+			, winning_trades
+			, final_equity
+			, max_drawdown
+			, sharpe
+			, sortino
+			, fees
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`, pnl.RunID, pnl.Predictor, pnl.Leverage, pnl.FeeRate, pnl.Slippage, pnl.MinNumDiff,
+		pnl.Trades, pnl.WinningTrades, pnl.FinalEquity, pnl.MaxDrawdown,
+		nullIfNaN(pnl.Sharpe), nullIfNaN(pnl.Sortino), pnl.Fees,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	const columns = 6
+	for start := 0; start < len(curve); start += evaluationInsertBatch {
+		batch := curve[start:min(start+evaluationInsertBatch, len(curve))]
+		placeholders := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*columns)
+		for i, e := range batch {
+			n := i * columns
+			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6))
+			args = append(args, id, e.Time, e.Position, e.PeriodReturn, e.Equity, e.Drawdown)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO evaluation_equity (pnl_id, time, position, period_return, equity, drawdown)
+			VALUES `+strings.Join(placeholders, ", "), args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
@@ -0,0 +1,374 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Rows for the Binance futures user-data stream. Every table has a unique key
+// so replays after a reconnect are dropped by ON CONFLICT DO NOTHING.
+
+type FuturesOrderUpdate struct {
+	OrderID         int64
+	TradeID         int64
+	EventTime       time.Time
+	TradeTime       time.Time
+	Symbol          string
+	ClientOrderID   string
+	Side            string
+	PositionSide    string
+	OrderType       string
+	ExecutionType   string // NEW, TRADE, CANCELED, EXPIRED, AMENDMENT ...
+	Status          string // NEW, PARTIALLY_FILLED, FILLED, CANCELED, EXPIRED ...
+	OrigQty         float64
+	OrigPrice       float64
+	AvgPrice        float64
+	LastFilledQty   float64
+	LastFilledPrice float64
+	AccumulatedQty  float64
+	Commission      float64
+	CommissionAsset string
+	RealizedPnl     float64
+	IsMaker         bool
+	ReduceOnly      bool
+}
+
+type FuturesBalance struct {
+	Asset              string
+	WalletBalance      float64
+	CrossWalletBalance float64
+	BalanceChange      float64
+}
+
+type FuturesPosition struct {
+	Symbol         string
+	PositionSide   string
+	PositionAmt    float64
+	EntryPrice     float64
+	MarkPrice      float64
+	UnrealizedPnl  float64
+	MarginType     string
+	IsolatedWallet float64
+	MaintMargin    float64
+}
+
+type FuturesAccountUpdate struct {
+	EventTime       time.Time
+	TransactionTime time.Time
+	Reason          string
+	Balances        []FuturesBalance
+	Positions       []FuturesPosition
+}
+
+type FuturesMarginCall struct {
+	EventTime          time.Time
+	CrossWalletBalance float64
+	Positions          []FuturesPosition
+}
+
+func (p *Postgresql) InsertFuturesOrderUpdate(o FuturesOrderUpdate) error {
+	query := `
+		INSERT INTO trading.futures_order_update (
+			recorded_at
+			, order_id
+			, trade_id
+			, event_time
+			, trade_time
+			, symbol
+			, client_order_id
+			, side
+			, position_side
+			, order_type
+			, execution_type
+			, status
+			, orig_qty
+			, orig_price
+			, avg_price
+			, last_filled_qty
+			, last_filled_price
+			, accumulated_qty
+			, commission
+			, commission_asset
+			, realized_pnl
+			, is_maker
+			, reduce_only
+		)
+		VALUES (
+			current_timestamp
+			, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22
+		)
+		ON CONFLICT (order_id, trade_id, event_time) DO NOTHING
+	`
+	_, err := p.DB.Exec(query,
+		o.OrderID, o.TradeID, o.EventTime, o.TradeTime, o.Symbol, o.ClientOrderID,
+		o.Side, o.PositionSide, o.OrderType, o.ExecutionType, o.Status,
+		o.OrigQty, o.OrigPrice, o.AvgPrice, o.LastFilledQty, o.LastFilledPrice,
+		o.AccumulatedQty, o.Commission, o.CommissionAsset, o.RealizedPnl,
+		o.IsMaker, o.ReduceOnly,
+	)
+	return err
+}
+
+// InsertFuturesAccountUpdate writes balances and positions of one ACCOUNT_UPDATE atomically
+func (p *Postgresql) InsertFuturesAccountUpdate(a FuturesAccountUpdate) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	balanceQuery := `
+		INSERT INTO trading.futures_balance_update (
+			recorded_at
+			, event_time
+			, transaction_time
+			, reason
+			, asset
+			, wallet_balance
+			, cross_wallet_balance
+			, balance_change
+		)
+		VALUES (current_timestamp, $1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (event_time, asset) DO NOTHING
+	`
+	for _, b := range a.Balances {
+		_, err := tx.Exec(balanceQuery,
+			a.EventTime, a.TransactionTime, a.Reason,
+			b.Asset, b.WalletBalance, b.CrossWalletBalance, b.BalanceChange,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	positionQuery := `
+		INSERT INTO trading.futures_position_update (
+			recorded_at
+			, event_time
+			, transaction_time
+			, reason
+			, symbol
+			, position_side
+			, position_amt
+			, entry_price
+			, unrealized_pnl
+			, margin_type
+			, isolated_wallet
+		)
+		VALUES (current_timestamp, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (event_time, symbol, position_side) DO NOTHING
+	`
+	for _, pos := range a.Positions {
+		_, err := tx.Exec(positionQuery,
+			a.EventTime, a.TransactionTime, a.Reason,
+			pos.Symbol, pos.PositionSide, pos.PositionAmt, pos.EntryPrice,
+			pos.UnrealizedPnl, pos.MarginType, pos.IsolatedWallet,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InsertFuturesMarginCall writes the positions of one MARGIN_CALL atomically
+func (p *Postgresql) InsertFuturesMarginCall(m FuturesMarginCall) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO trading.futures_margin_call (
+			recorded_at
+			, event_time
+			, cross_wallet_balance
+			, symbol
+			, position_side
+			, position_amt
+			, margin_type
+			, isolated_wallet
+			, mark_price
+			, unrealized_pnl
+			, maint_margin
+		)
+		VALUES (current_timestamp, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (event_time, symbol, position_side) DO NOTHING
+	`
+	for _, pos := range m.Positions {
+		_, err := tx.Exec(query,
+			m.EventTime, m.CrossWalletBalance,
+			pos.Symbol, pos.PositionSide, pos.PositionAmt, pos.MarginType,
+			pos.IsolatedWallet, pos.MarkPrice, pos.UnrealizedPnl, pos.MaintMargin,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgresql) InsertFuturesAccountConfigUpdate(eventTime time.Time, symbol string, leverage int64) error {
+	query := `
+		INSERT INTO trading.futures_account_config_update (
+			recorded_at
+			, event_time
+			, symbol
+			, leverage
+		)
+		VALUES (current_timestamp, $1, $2, $3)
+		ON CONFLICT (event_time, symbol) DO NOTHING
+	`
+	_, err := p.DB.Exec(query, eventTime, symbol, leverage)
+	return err
+}
+
+// InsertFuturesRawEvent keeps event types without a dedicated table as JSON
+func (p *Postgresql) InsertFuturesRawEvent(eventType string, eventTime time.Time, payload []byte) error {
+	query := `
+		INSERT INTO trading.futures_user_event (
+			recorded_at
+			, event_type
+			, event_time
+			, payload_hash
+			, payload
+		)
+		VALUES (current_timestamp, $1, $2, $3, $4)
+		ON CONFLICT (event_type, event_time, payload_hash) DO NOTHING
+	`
+	hash := sha256.Sum256(payload)
+	_, err := p.DB.Exec(query, eventType, eventTime, hex.EncodeToString(hash[:]), string(payload))
+	return err
+}
+
+// OpenStreamGap records that the user stream stopped observing the account at
+// from. The gap stays open (gap_end NULL) until CloseStreamGaps, so an outage
+// the process doesn't survive is still on record.
+func (p *Postgresql) OpenStreamGap(from time.Time, reason string) error {
+	query := `
+		INSERT INTO trading.futures_stream_gap (
+			recorded_at
+			, gap_start
+			, reason
+		)
+		VALUES (current_timestamp, $1, $2)
+		ON CONFLICT (gap_start) DO NOTHING
+	`
+	_, err := p.DB.Exec(query, from, reason)
+	return err
+}
+
+// CloseStreamGaps ends every open gap at to, including the ones left by a
+// process that stopped while disconnected
+func (p *Postgresql) CloseStreamGaps(to time.Time) error {
+	query := `
+		UPDATE trading.futures_stream_gap
+		SET gap_end = GREATEST($1, gap_start)
+		WHERE gap_end IS NULL
+	`
+	_, err := p.DB.Exec(query, to)
+	return err
+}
+
+// UnrepairedStreamGaps lists the open and closed gaps no backfill covered yet, oldest first
+func (p *Postgresql) UnrepairedStreamGaps() ([]StreamGap, error) {
+	rows, err := p.DB.Query(`
+		SELECT gap_start, gap_end, COALESCE(reason, '')
+		FROM trading.futures_stream_gap
+		WHERE repaired_at IS NULL
+		ORDER BY gap_start ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gaps []StreamGap
+	for rows.Next() {
+		var g StreamGap
+		var end *time.Time
+		if err := rows.Scan(&g.From, &end, &g.Reason); err != nil {
+			return nil, err
+		}
+		if end != nil {
+			g.To = *end
+		}
+		gaps = append(gaps, g)
+	}
+	return gaps, rows.Err()
+}
+
+// MarkStreamGapsRepaired marks the closed gaps that ended by before as covered by a backfill
+func (p *Postgresql) MarkStreamGapsRepaired(before time.Time) error {
+	query := `
+		UPDATE trading.futures_stream_gap
+		SET repaired_at = current_timestamp
+		WHERE repaired_at IS NULL
+			AND gap_end IS NOT NULL
+			AND gap_end <= $1
+	`
+	_, err := p.DB.Exec(query, before)
+	return err
+}
+
+// futuresUniqueKeys are the unique constraints the ON CONFLICT clauses above
+// rely on, created with their tables by migration 0006_futures_user_stream
+var futuresUniqueKeys = []string{
+	"futures_order_update_key",
+	"futures_balance_update_key",
+	"futures_position_update_key",
+	"futures_margin_call_key",
+	"futures_account_config_update_key",
+	"futures_user_event_key",
+	"futures_stream_gap_key",
+}
+
+// CheckFuturesSchema fails when a trading table or its unique key is missing,
+// e.g. on a database that was never migrated, before any event is lost to it
+func (p *Postgresql) CheckFuturesSchema(ctx context.Context) error {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT c.conname
+		FROM pg_constraint c
+		JOIN pg_namespace n ON n.oid = c.connamespace
+		WHERE n.nspname = 'trading'
+			AND c.contype = 'u'
+			AND c.conname = ANY($1)
+	`, pq.Array(futuresUniqueKeys))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool, len(futuresUniqueKeys))
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		found[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, key := range futuresUniqueKeys {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("trading schema is missing %s, apply the migrations with vqm migrate up", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"encoding/json"
+)
+
+// Host is stored with every metric row: resource plus free-form labels
+type Host struct {
+	Resource string
+	Labels   map[string]string
+}
+
+// HostIdentity is one row of host_identity
+type HostIdentity struct {
+	Resource         string
+	Hostname         string
+	InstanceID       string
+	InstanceType     string
+	AvailabilityZone string
+	Region           string
+	Labels           map[string]string
+}
+
+func (h Host) labelsJSON() (string, error) {
+	if len(h.Labels) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(h.Labels)
+	return string(raw), err
+}
+
+// UpsertHostIdentity records the host, first_seen is kept across restarts
+func (p *Postgresql) UpsertHostIdentity(h HostIdentity) error {
+	labels, err := Host{Labels: h.Labels}.labelsJSON()
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO host_identity (
+			resource
+			, hostname
+			, instance_id
+			, instance_type
+			, availability_zone
+			, region
+			, labels
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (resource) DO UPDATE SET
+			hostname = EXCLUDED.hostname
+			, instance_id = EXCLUDED.instance_id
+			, instance_type = EXCLUDED.instance_type
+			, availability_zone = EXCLUDED.availability_zone
+			, region = EXCLUDED.region
+			, labels = EXCLUDED.labels
+			, last_seen = current_timestamp
+	`
+	_, err = p.DB.Exec(query,
+		h.Resource, h.Hostname, h.InstanceID, h.InstanceType, h.AvailabilityZone, h.Region, labels,
+	)
+	return err
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// HostDetail is one detailed host sample, written to the host_* tables
+type HostDetail struct {
+	RecordedAt     time.Time
+	Load1          float64
+	Load5          float64
+	Load15         float64
+	SwapTotalBytes uint64
+	SwapUsedBytes  uint64
+	SwapPercent    float64
+	ProcessCount   int
+	Cores          []CPUCoreSample
+	Interfaces     []NetworkSample
+	Disks          []DiskIOSample
+	Filesystems    []FilesystemSample
+	Processes      []ProcessSample
+}
+
+type CPUCoreSample struct {
+	Core       int
+	CpuPercent float64
+}
+
+// NetworkSample holds rates per second and error/drop counts since the previous sample
+type NetworkSample struct {
+	Interface       string
+	RxBytesPerSec   float64
+	TxBytesPerSec   float64
+	RxPacketsPerSec float64
+	TxPacketsPerSec float64
+	RxErrors        uint64
+	TxErrors        uint64
+	RxDropped       uint64
+	TxDropped       uint64
+}
+
+type DiskIOSample struct {
+	Device           string
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+	ReadOpsPerSec    float64
+	WriteOpsPerSec   float64
+	BusyPercent      float64
+}
+
+type FilesystemSample struct {
+	Mountpoint    string
+	Device        string
+	Fstype        string
+	TotalBytes    uint64
+	UsedBytes     uint64
+	UsedPercent   float64
+	InodesTotal   uint64
+	InodesUsed    uint64
+	InodesPercent float64
+}
+
+type ProcessSample struct {
+	Pid        int32
+	Name       string
+	CpuPercent float64
+	RssBytes   uint64
+	MemPercent float64
+}
+
+// HostDetailRecord is a sample with the host it was taken on, the unit of a batch
+type HostDetailRecord struct {
+	Host   Host
+	Detail HostDetail
+}
+
+// InsertHostDetail writes every part of the sample in one transaction
+func (p *Postgresql) InsertHostDetail(host Host, d HostDetail) error {
+	return p.InsertHostDetails([]HostDetailRecord{{Host: host, Detail: d}})
+}
+
+// InsertHostDetails writes the samples in one transaction, a failed batch
+// leaves nothing behind and can be retried without duplicates
+func (p *Postgresql) InsertHostDetails(records []HostDetailRecord) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range records {
+		if err := insertHostDetail(tx, r.Host, r.Detail); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insertHostDetail(tx *sql.Tx, host Host, d HostDetail) error {
+	labels, err := host.labelsJSON()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO host_system (
+			recorded_at
+			, resource
+			, load1
+			, load5
+			, load15
+			, swap_total_bytes
+			, swap_used_bytes
+			, swap_pct
+			, process_count
+			, labels
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, d.RecordedAt, host.Resource, d.Load1, d.Load5, d.Load15,
+		int64(d.SwapTotalBytes), int64(d.SwapUsedBytes), d.SwapPercent, d.ProcessCount, labels,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range d.Cores {
+		_, err := tx.Exec(`
+			INSERT INTO host_cpu_core (recorded_at, resource, core, cpu_pct, labels)
+			VALUES ($1, $2, $3, $4, $5)
+		`, d.RecordedAt, host.Resource, c.Core, c.CpuPercent, labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, n := range d.Interfaces {
+		_, err := tx.Exec(`
+			INSERT INTO host_network (
+				recorded_at
+				, resource
+				, interface
+				, rx_bytes_per_sec
+				, tx_bytes_per_sec
+				, rx_packets_per_sec
+				, tx_packets_per_sec
+				, rx_errors
+				, tx_errors
+				, rx_dropped
+				, tx_dropped
+				, labels
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, d.RecordedAt, host.Resource, n.Interface,
+			n.RxBytesPerSec, n.TxBytesPerSec, n.RxPacketsPerSec, n.TxPacketsPerSec,
+			int64(n.RxErrors), int64(n.TxErrors), int64(n.RxDropped), int64(n.TxDropped), labels,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, io := range d.Disks {
+		_, err := tx.Exec(`
+			INSERT INTO host_disk_io (
+				recorded_at
+				, resource
+				, device
+				, read_bytes_per_sec
+				, write_bytes_per_sec
+				, read_ops_per_sec
+				, write_ops_per_sec
+				, busy_pct
+				, labels
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, d.RecordedAt, host.Resource, io.Device,
+			io.ReadBytesPerSec, io.WriteBytesPerSec, io.ReadOpsPerSec, io.WriteOpsPerSec, io.BusyPercent, labels,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fs := range d.Filesystems {
+		_, err := tx.Exec(`
+			INSERT INTO host_filesystem (
+				recorded_at
+				, resource
+				, mountpoint
+				, device
+				, fstype
+				, total_bytes
+				, used_bytes
+				, used_pct
+				, inodes_total
+				, inodes_used
+				, inodes_pct
+				, labels
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, d.RecordedAt, host.Resource, fs.Mountpoint, fs.Device, fs.Fstype,
+			int64(fs.TotalBytes), int64(fs.UsedBytes), fs.UsedPercent,
+			int64(fs.InodesTotal), int64(fs.InodesUsed), fs.InodesPercent, labels,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, proc := range d.Processes {
+		_, err := tx.Exec(`
+			INSERT INTO host_process (recorded_at, resource, pid, name, cpu_pct, rss_bytes, mem_pct, labels)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, d.RecordedAt, host.Resource, proc.Pid, proc.Name, proc.CpuPercent, int64(proc.RssBytes), proc.MemPercent, labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
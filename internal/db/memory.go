@@ -0,0 +1,285 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements every store interface in memory for unit tests
+type MemoryStore struct {
+	mu          sync.Mutex
+	HostMetrics []HostMetric
+	HostDetails []HostDetail
+	Containers  []ContainerMetric
+	Positions   []PositionHistory
+	Gaps        []StreamGap // Not repaired yet
+	Repaired    []StreamGap
+	Patterns    []Pattern
+	Evaluations []EvaluationRun
+	Predictions map[int64][]EvaluationPrediction
+	Pnls        []EvaluationPnl
+	Equity      map[int64][]EquityPoint
+
+	// Err, when set, is returned by every insert to simulate an outage
+	Err error
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// SetErr starts or ends an outage while other goroutines use the store
+func (m *MemoryStore) SetErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Err = err
+}
+
+func (m *MemoryStore) InsertHostMetrics(metrics []HostMetric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.HostMetrics = append(m.HostMetrics, metrics...)
+	return nil
+}
+
+func (m *MemoryStore) InsertHostDetail(host Host, d HostDetail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.HostDetails = append(m.HostDetails, d)
+	return nil
+}
+
+func (m *MemoryStore) InsertContainerMetrics(host Host, metrics []ContainerMetric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Containers = append(m.Containers, metrics...)
+	return nil
+}
+
+func (m *MemoryStore) InsertHostDetails(records []HostDetailRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	for _, r := range records {
+		m.HostDetails = append(m.HostDetails, r.Detail)
+	}
+	return nil
+}
+
+func (m *MemoryStore) InsertContainerRecords(records []ContainerRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	for _, r := range records {
+		m.Containers = append(m.Containers, r.Metrics...)
+	}
+	return nil
+}
+
+// InsertPositionHistory mirrors ON CONFLICT (close_timestamp, symbol, position_side) DO NOTHING
+func (m *MemoryStore) InsertPositionHistory(p PositionHistory) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return false, m.Err
+	}
+	for _, existing := range m.Positions {
+		if existing.CloseTime.Equal(p.CloseTime) && existing.Symbol == p.Symbol && existing.PositionSide == p.PositionSide {
+			return false, nil
+		}
+	}
+	m.Positions = append(m.Positions, p)
+	return true, nil
+}
+
+func (m *MemoryStore) OpenStreamGap(from time.Time, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	for _, g := range m.Gaps {
+		if g.From.Equal(from) {
+			return nil
+		}
+	}
+	m.Gaps = append(m.Gaps, StreamGap{From: from, Reason: reason})
+	return nil
+}
+
+func (m *MemoryStore) CloseStreamGaps(to time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	for i := range m.Gaps {
+		if m.Gaps[i].To.IsZero() {
+			m.Gaps[i].To = maxTime(to, m.Gaps[i].From)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) UnrepairedStreamGaps() ([]StreamGap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	gaps := append([]StreamGap(nil), m.Gaps...)
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].From.Before(gaps[j].From)
+	})
+	return gaps, nil
+}
+
+func (m *MemoryStore) MarkStreamGapsRepaired(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	var open []StreamGap
+	for _, g := range m.Gaps {
+		if !g.To.IsZero() && !g.To.After(before) {
+			m.Repaired = append(m.Repaired, g)
+		} else {
+			open = append(open, g)
+		}
+	}
+	m.Gaps = open
+	return nil
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (m *MemoryStore) RandomPattern(universe Universe, target Target) (Pattern, error) {
+	if _, err := target.column(); err != nil {
+		return Pattern{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matches []Pattern
+	for _, p := range m.Patterns {
+		if universe.matches(p) && p.HasLabel(target) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return Pattern{}, fmt.Errorf("no rows found in random selection")
+	}
+	return matches[rand.IntN(len(matches))], nil
+}
+
+func (m *MemoryStore) NearestPatterns(embedding []float32, filter NeighborFilter, k int) ([]Pattern, error) {
+	if _, err := filter.Target.column(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matches []Pattern
+	for _, p := range m.Patterns {
+		if !filter.matches(p) || !filter.contains(p.Time) || !p.HasLabel(filter.Target) {
+			continue
+		}
+		p.Distance = CosineDistance(embedding, p.Embedding)
+		matches = append(matches, p)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+func (m *MemoryStore) PatternsBetween(symbol string, interval string, target Target, from time.Time, to time.Time) ([]Pattern, error) {
+	if _, err := target.column(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter := NeighborFilter{From: from, To: to}
+	var matches []Pattern
+	for _, p := range m.Patterns {
+		if p.Symbol == symbol && p.Interval == interval && filter.contains(p.Time) && p.HasLabel(target) {
+			matches = append(matches, p)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Time.Before(matches[j].Time)
+	})
+	return matches, nil
+}
+
+func (m *MemoryStore) InsertEvaluationRun(run EvaluationRun, predictions []EvaluationPrediction) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	m.Evaluations = append(m.Evaluations, run)
+	id := int64(len(m.Evaluations))
+	if m.Predictions == nil {
+		m.Predictions = map[int64][]EvaluationPrediction{}
+	}
+	m.Predictions[id] = predictions
+	return id, nil
+}
+
+func (m *MemoryStore) InsertEvaluationPnl(pnl EvaluationPnl, curve []EquityPoint) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	m.Pnls = append(m.Pnls, pnl)
+	id := int64(len(m.Pnls))
+	if m.Equity == nil {
+		m.Equity = map[int64][]EquityPoint{}
+	}
+	m.Equity[id] = curve
+	return id, nil
+}
+
+// CosineDistance matches pgvector's <=> operator
+func CosineDistance(a []float32, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return math.NaN()
+	}
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+)
+
+// patternColumns are the columns scanPattern reads, in this order
+const patternColumns = `time, symbol, interval, next_return, next_slope_3, next_slope_5, embedding`
+
+// scanPattern reads patternColumns followed by extra, a NULL label reads as 0
+// and is listed in Unlabelled
+func scanPattern(row interface{ Scan(...any) error }, extra ...any) (Pattern, error) {
+	var r Pattern
+	var rawTime int64
+	var nextReturn, slope3, slope5 *float64
+	var vec pgvector.Vector
+
+	dest := append([]any{&rawTime, &r.Symbol, &r.Interval, &nextReturn, &slope3, &slope5, &vec}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return Pattern{}, err
+	}
+
+	r.Time = time.Unix(rawTime, 0).UTC()
+	for _, label := range []struct {
+		target Target
+		value  *float64
+		dest   *float64
+	}{
+		{TargetNextReturn, nextReturn, &r.NextReturn},
+		{TargetNextSlope3, slope3, &r.NextSlope3},
+		{TargetNextSlope5, slope5, &r.NextSlope5},
+	} {
+		if label.value != nil {
+			*label.dest = *label.value
+		} else {
+			r.Unlabelled = append(r.Unlabelled, label.target)
+		}
+	}
+	r.Embedding = vec.Slice()
+	return r, nil
+}
+
+// listOrNull passes a list as a text[] parameter, an empty list as NULL to match any
+func listOrNull(list []string) any {
+	if len(list) == 0 {
+		return nil
+	}
+	return pq.Array(list)
+}
+
+func (p *Postgresql) RandomPattern(universe Universe, target Target) (Pattern, error) {
+	column, err := target.column()
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	// Sampling 0.1% of the pages is cheap but may miss a small universe,
+	// the full scan is the fallback
+	for _, sample := range []string{"TABLESAMPLE SYSTEM(0.1)", ""} {
+		query := fmt.Sprintf(`
+            SELECT %s
+            FROM market_pattern_go %s
+            WHERE close_price IS NOT NULL
+                AND %s IS NOT NULL
+                AND ($1::text[] IS NULL OR symbol = ANY($1))
+                AND ($2::text[] IS NULL OR interval = ANY($2))
+            ORDER BY random()
+            LIMIT 1
+        `, patternColumns, sample, column)
+
+		pattern, err := scanPattern(p.DB.QueryRow(query, listOrNull(universe.Symbols), listOrNull(universe.Intervals)))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		return pattern, err
+	}
+	return Pattern{}, fmt.Errorf("no rows found in random selection")
+}
+
+func (p *Postgresql) PatternsBetween(symbol string, interval string, target Target, from time.Time, to time.Time) ([]Pattern, error) {
+	column, err := target.column()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM market_pattern_go
+        WHERE %s IS NOT NULL
+            AND symbol = $1
+            AND interval = $2
+            AND time >= $3
+            AND time <= $4
+        ORDER BY time ASC
+    `, patternColumns, column)
+
+	rows, err := p.DB.Query(query, symbol, interval, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []Pattern
+	for rows.Next() {
+		r, err := scanPattern(rows)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, r)
+	}
+	return patterns, rows.Err()
+}
+
+// The HNSW index applies the WHERE clause after the index scan, so a narrow
+// time filter can leave fewer than k rows out of the ef_search candidates.
+// The candidate list is widened with k, up to pgvector's maximum.
+const maxEfSearch = 1000
+
+func (p *Postgresql) NearestPatterns(embedding []float32, filter NeighborFilter, k int) ([]Pattern, error) {
+	column, err := filter.Target.column()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+        SELECT %s,
+            (embedding <=> $1) as distance
+        FROM market_pattern_go
+        WHERE %s IS NOT NULL
+            AND ($2::text[] IS NULL OR symbol = ANY($2))
+            AND ($3::text[] IS NULL OR interval = ANY($3))
+            AND ($4::bigint IS NULL OR time >= $4)
+            AND ($5::bigint IS NULL OR time <= $5)
+        ORDER BY distance ASC
+        LIMIT $6
+    `, patternColumns, column)
+
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Read only, rolling back just ends the transaction
+	defer tx.Rollback()
+
+	efSearch := min(max(k*10, 40), maxEfSearch)
+	if _, err := tx.Exec(fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", efSearch)); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(query, pgvector.NewVector(embedding),
+		listOrNull(filter.Symbols), listOrNull(filter.Intervals),
+		unixOrNull(filter.From), unixOrNull(filter.To), k)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []Pattern
+	for rows.Next() {
+		var distance float64
+		r, err := scanPattern(rows, &distance)
+		if err != nil {
+			return nil, err
+		}
+		r.Distance = distance
+		patterns = append(patterns, r)
+	}
+	return patterns, rows.Err()
+}
+
+// unixOrNull turns a zero time into NULL for optional bounds
+func unixOrNull(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	unix := t.Unix()
+	return &unix
+}
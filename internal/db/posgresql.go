@@ -2,8 +2,11 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"log/slog"
-	"time"
+	"strings"
+
+	"vector-quant-monitor/internal/config"
 
 	_ "github.com/lib/pq"
 )
@@ -21,53 +24,103 @@ func NewPostgreSQLDB(connectionString string, log *slog.Logger) *Postgresql {
 	return &Postgresql{DB: db}
 }
 
+// ConnectionString builds the DSN from the database settings
+func ConnectionString(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		cfg.DBUser,
+		cfg.DBPassword,
+		cfg.DBHost,
+		cfg.DBPort,
+		cfg.DBName,
+	)
+}
+
+// Connect opens the configured database, the connection itself is established lazily
+func Connect(cfg config.DatabaseConfig, log *slog.Logger) (*Postgresql, error) {
+	log.Info(fmt.Sprintf("Connecting to PostgresqldDB to %s", cfg.DBName))
+	db, err := sql.Open("postgres", ConnectionString(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return &Postgresql{DB: db}, nil
+}
+
 func CloseDB(db *sql.DB) error {
 	return db.Close()
 }
 
-func (p *Postgresql) InsertHostMetrics(db *sql.DB, cpuPercent float64, ramPercent float64, diskPercent float64) error {
-	// TODO Change host to parameterized value it could be the name of ec2 node
+// InsertHostMetrics writes the samples with a single multi-row insert
+func (p *Postgresql) InsertHostMetrics(metrics []HostMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	const columns = 6
+	placeholders := make([]string, 0, len(metrics))
+	args := make([]any, 0, len(metrics)*columns)
+	for i, m := range metrics {
+		labels, err := m.Host.labelsJSON()
+		if err != nil {
+			return err
+		}
+		n := i * columns
+		placeholders = append(placeholders,
+			fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6))
+		args = append(args, m.RecordedAt, m.Host.Resource, m.CpuPercent, m.RamPercent, m.DiskPercent, labels)
+	}
+
 	query := `
-		INSERT INTO system_metric (recorded_at, resource, cpu_pct, mem_pct, disk_pct)
-		VALUES (current_timestamp, 'ec2-host', $1, $2, $3)
-	`
-	_, err := p.DB.Exec(query, cpuPercent, ramPercent, diskPercent)
+		INSERT INTO system_metric (recorded_at, resource, cpu_pct, mem_pct, disk_pct, labels)
+		VALUES ` + strings.Join(placeholders, ", ")
+	_, err := p.DB.Exec(query, args...)
 	return err
 }
 
-func (p *Postgresql) InsertPositionHistory(
-	db *sql.DB,
-	symbol string,
-	side string,
-	positionSide string,
-	netPnl float64,
-	vol float64,
-	openTime time.Time,
-	closeTime time.Time,
-) error {
+// InsertPositionHistory reports false when the position was already stored
+func (p *Postgresql) InsertPositionHistory(h PositionHistory) (bool, error) {
 	query := `
 		INSERT INTO trading.position_history (
 			recorded_at
 			, market
 			, symbol
 			, side
+			, position_side
+			, gross_pnl
+			, fees
+			, funding
 			, net_pnl
 			, volume
+			, avg_entry_price
+			, avg_exit_price
 			, open_timestamp
 			, close_timestamp
 		)
 		VALUES (
 			current_timestamp
-			, 0
 			, $1
 			, $2
 			, $3
 			, $4
 			, $5
 			, $6
+			, $7
+			, $8
+			, $9
+			, $10
+			, $11
+			, $12
+			, $13
 		)
-		ON CONFLICT (open_timestamp, symbol) DO NOTHING
+		ON CONFLICT (close_timestamp, symbol, position_side) DO NOTHING
 	`
-	_, err := p.DB.Exec(query, symbol, side, netPnl, vol, openTime, closeTime)
-	return err
+	res, err := p.DB.Exec(query,
+		h.Market, h.Symbol, h.Side, h.PositionSide, h.GrossPnl, h.Fees, h.Funding, h.NetPnl,
+		h.Volume, h.AvgEntryPrice, h.AvgExitPrice, h.OpenTime, h.CloseTime,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
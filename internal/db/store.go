@@ -0,0 +1,151 @@
+package db
+
+import (
+	"slices"
+	"time"
+)
+
+// Narrow stores consumed by monitor, backfill and vector. Postgresql implements
+// all of them against the real schema, MemoryStore keeps everything in memory for tests.
+
+type MetricStore interface {
+	InsertHostMetrics(metrics []HostMetric) error
+}
+
+type HostDetailStore interface {
+	InsertHostDetail(host Host, d HostDetail) error
+}
+
+type ContainerStore interface {
+	InsertContainerMetrics(host Host, metrics []ContainerMetric) error
+}
+
+// SampleBatchStore writes batches of queued samples, each batch atomically
+type SampleBatchStore interface {
+	MetricStore
+	InsertHostDetails(records []HostDetailRecord) error
+	InsertContainerRecords(records []ContainerRecord) error
+}
+
+type PositionStore interface {
+	// InsertPositionHistory returns false when the position already exists
+	InsertPositionHistory(p PositionHistory) (bool, error)
+}
+
+type StreamGapStore interface {
+	// OpenStreamGap records a user stream outage starting at from
+	OpenStreamGap(from time.Time, reason string) error
+	// CloseStreamGaps ends every open outage at to
+	CloseStreamGaps(to time.Time) error
+	// UnrepairedStreamGaps lists the open and closed outages no backfill covered yet, oldest first
+	UnrepairedStreamGaps() ([]StreamGap, error)
+	// MarkStreamGapsRepaired marks the closed outages that ended by before as covered
+	MarkStreamGapsRepaired(before time.Time) error
+}
+
+type PatternStore interface {
+	// RandomPattern samples a row of universe labelled with target to use as prediction query
+	RandomPattern(universe Universe, target Target) (Pattern, error)
+	// NearestPatterns returns the k labelled rows matching filter closest to embedding by cosine distance
+	NearestPatterns(embedding []float32, filter NeighborFilter, k int) ([]Pattern, error)
+	// PatternsBetween returns the rows of symbol/interval labelled with target in [from, to] oldest first
+	PatternsBetween(symbol string, interval string, target Target, from time.Time, to time.Time) ([]Pattern, error)
+}
+
+type EvaluationStore interface {
+	// InsertEvaluationRun stores a run with its predictions and returns the run id
+	InsertEvaluationRun(run EvaluationRun, predictions []EvaluationPrediction) (int64, error)
+	// InsertEvaluationPnl stores a simulation of a run with its equity curve and returns its id
+	InsertEvaluationPnl(pnl EvaluationPnl, curve []EquityPoint) (int64, error)
+}
+
+// HostMetric is one row of system_metric
+type HostMetric struct {
+	Host        Host
+	RecordedAt  time.Time
+	CpuPercent  float64
+	RamPercent  float64
+	DiskPercent float64
+}
+
+type PositionHistory struct {
+	Market        string
+	Symbol        string
+	Side          string
+	PositionSide  string
+	GrossPnl      float64
+	Fees          float64
+	Funding       float64
+	NetPnl        float64
+	Volume        float64
+	AvgEntryPrice float64
+	AvgExitPrice  float64
+	OpenTime      time.Time
+	CloseTime     time.Time
+}
+
+// StreamGap is one row of trading.futures_stream_gap, a window in which the
+// user stream was not connected. To is zero while the gap is still open.
+type StreamGap struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+// Pattern is one row of market_pattern_go
+type Pattern struct {
+	Time       time.Time
+	Symbol     string
+	Interval   string
+	NextReturn float64
+	NextSlope3 float64
+	NextSlope5 float64
+	Unlabelled []Target // Labels that are NULL, the latest candles don't have them yet
+	Embedding  []float32
+	Distance   float64 // Only set by NearestPatterns
+}
+
+// Universe selects patterns by symbol and interval, an empty list matches any
+type Universe struct {
+	Symbols   []string
+	Intervals []string
+}
+
+// matches reports whether a pattern belongs to the universe
+func (u Universe) matches(p Pattern) bool {
+	return (len(u.Symbols) == 0 || slices.Contains(u.Symbols, p.Symbol)) &&
+		(len(u.Intervals) == 0 || slices.Contains(u.Intervals, p.Interval))
+}
+
+// NeighborFilter limits the rows NearestPatterns may return
+type NeighborFilter struct {
+	Universe
+	Target Target    // Rows without this label are skipped
+	From   time.Time // Earliest pattern time, zero for no limit
+	To     time.Time // Latest pattern time (inclusive), zero for no limit
+}
+
+// contains reports whether a pattern time is inside [From, To]
+func (f NeighborFilter) contains(t time.Time) bool {
+	return (f.From.IsZero() || !t.Before(f.From)) && (f.To.IsZero() || !t.After(f.To))
+}
+
+var (
+	_ MetricStore      = (*Postgresql)(nil)
+	_ HostDetailStore  = (*Postgresql)(nil)
+	_ ContainerStore   = (*Postgresql)(nil)
+	_ SampleBatchStore = (*Postgresql)(nil)
+	_ PositionStore    = (*Postgresql)(nil)
+	_ StreamGapStore   = (*Postgresql)(nil)
+	_ PatternStore     = (*Postgresql)(nil)
+	_ EvaluationStore  = (*Postgresql)(nil)
+
+	_ MetricStore      = (*MemoryStore)(nil)
+	_ HostDetailStore  = (*MemoryStore)(nil)
+	_ ContainerStore   = (*MemoryStore)(nil)
+	_ SampleBatchStore = (*MemoryStore)(nil)
+	_ PositionStore    = (*MemoryStore)(nil)
+	_ StreamGapStore   = (*MemoryStore)(nil)
+	_ PatternStore     = (*MemoryStore)(nil)
+	_ EvaluationStore  = (*MemoryStore)(nil)
+)
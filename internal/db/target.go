@@ -0,0 +1,72 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Target is the label of market_pattern_go a prediction is scored against
+type Target string
+
+const (
+	TargetNextReturn Target = "next_return"
+	TargetNextSlope3 Target = "next_slope_3"
+	TargetNextSlope5 Target = "next_slope_5"
+)
+
+var Targets = []Target{TargetNextReturn, TargetNextSlope3, TargetNextSlope5}
+
+func ParseTarget(s string) (Target, error) {
+	for _, t := range Targets {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	names := make([]string, len(Targets))
+	for i, t := range Targets {
+		names[i] = string(t)
+	}
+	return "", fmt.Errorf("unknown target %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// Horizon is the number of candles the label looks ahead
+func (t Target) Horizon() int {
+	switch t {
+	case TargetNextSlope3:
+		return 3
+	case TargetNextSlope5:
+		return 5
+	}
+	return 1
+}
+
+// column is the only way a target reaches SQL: the name comes from this
+// switch, never from the caller's string
+func (t Target) column() (string, error) {
+	switch t {
+	case TargetNextReturn:
+		return "next_return", nil
+	case TargetNextSlope3:
+		return "next_slope_3", nil
+	case TargetNextSlope5:
+		return "next_slope_5", nil
+	}
+	return "", fmt.Errorf("unknown target %q", string(t))
+}
+
+// Label is the value of target in the pattern
+func (p Pattern) Label(t Target) float64 {
+	switch t {
+	case TargetNextSlope3:
+		return p.NextSlope3
+	case TargetNextSlope5:
+		return p.NextSlope5
+	}
+	return p.NextReturn
+}
+
+// HasLabel reports whether target is known for the pattern, the stores skip rows without it
+func (p Pattern) HasLabel(t Target) bool {
+	return !slices.Contains(p.Unlabelled, t)
+}
@@ -0,0 +1,33 @@
+package db
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	for _, target := range Targets {
+		got, err := ParseTarget(string(target))
+		if err != nil || got != target {
+			t.Errorf("%s: got %q, %v", target, got, err)
+		}
+		if column, err := got.column(); err != nil || column != string(target) {
+			t.Errorf("%s: column %q, %v", target, column, err)
+		}
+	}
+
+	// Only the three columns ever reach SQL
+	for _, s := range []string{"", "NEXT_RETURN", " next_return", "next_slope_4", "close", "next_return; DROP TABLE market_pattern_go", `next_return"`} {
+		if got, err := ParseTarget(s); err == nil {
+			t.Errorf("%q: accepted as %q", s, got)
+		}
+		if column, err := Target(s).column(); err == nil {
+			t.Errorf("%q: column %q", s, column)
+		}
+	}
+}
+
+func TestTargetHorizon(t *testing.T) {
+	for target, want := range map[Target]int{TargetNextReturn: 1, TargetNextSlope3: 3, TargetNextSlope5: 5} {
+		if got := target.Horizon(); got != want {
+			t.Errorf("%s: horizon %d, want %d", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package health tracks the liveness of the components of a vqm process and
+// serves it as JSON on /healthz and /readyz.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Component is a unit of work that reports its successes, e.g. a host sample or a backfill run
+type Component struct {
+	name       string
+	critical   bool
+	staleAfter time.Duration // 0 means it never goes stale
+	check      func(ctx context.Context) error
+
+	mu           sync.Mutex
+	registeredAt time.Time
+	lastSuccess  time.Time
+	lastFailure  time.Time
+	lastError    string
+	details      map[string]any
+}
+
+// ComponentStatus is the JSON view of a Component
+type ComponentStatus struct {
+	Name        string         `json:"name"`
+	Critical    bool           `json:"critical"`
+	Healthy     bool           `json:"healthy"`
+	LastSuccess *time.Time     `json:"last_success,omitempty"`
+	AgeSeconds  *float64       `json:"age_seconds,omitempty"`
+	LastFailure *time.Time     `json:"last_failure,omitempty"`
+	LastError   string         `json:"last_error,omitempty"`
+	Details     map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status     string            `json:"status"` // ok or unavailable
+	Time       time.Time         `json:"time"`
+	Components []ComponentStatus `json:"components"`
+}
+
+var (
+	mu         sync.Mutex
+	components = map[string]*Component{}
+)
+
+// Register returns the component called name, creating it on first use.
+// A critical component fails readiness once its last success is older than
+// staleAfter, counting from registration until it first succeeds.
+func Register(name string, critical bool, staleAfter time.Duration) *Component {
+	mu.Lock()
+	defer mu.Unlock()
+	c, ok := components[name]
+	if !ok {
+		c = &Component{name: name, registeredAt: time.Now()}
+		components[name] = c
+	}
+	c.mu.Lock()
+	c.critical = critical
+	c.staleAfter = staleAfter
+	c.mu.Unlock()
+	return c
+}
+
+// RegisterCheck adds a component probed on every request instead of reporting itself, e.g. a DB ping
+func RegisterCheck(name string, critical bool, check func(ctx context.Context) error) *Component {
+	c := Register(name, critical, 0)
+	c.mu.Lock()
+	c.check = check
+	c.mu.Unlock()
+	return c
+}
+
+// Unregister removes the component from the reports, e.g. the DB probe of a
+// component that stopped. A component registered again under the name stays.
+func (c *Component) Unregister() {
+	mu.Lock()
+	defer mu.Unlock()
+	if components[c.name] == c {
+		delete(components, c.name)
+	}
+}
+
+func (c *Component) Success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSuccess = time.Now()
+	c.lastError = ""
+}
+
+func (c *Component) Failure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastFailure = time.Now()
+	c.lastError = err.Error()
+}
+
+// Set attaches an extra value to the component's JSON, e.g. the last event time
+func (c *Component) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.details == nil {
+		c.details = make(map[string]any)
+	}
+	c.details[key] = value
+}
+
+func (c *Component) status(ctx context.Context, now time.Time) ComponentStatus {
+	c.mu.Lock()
+	check := c.check
+	c.mu.Unlock()
+
+	if check != nil {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := check(checkCtx)
+		cancel()
+		if err != nil {
+			c.Failure(err)
+		} else {
+			c.Success()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := ComponentStatus{
+		Name:      c.name,
+		Critical:  c.critical,
+		Healthy:   true,
+		LastError: c.lastError,
+	}
+	if len(c.details) > 0 {
+		s.Details = make(map[string]any, len(c.details))
+		for k, v := range c.details {
+			s.Details[k] = v
+		}
+	}
+	if !c.lastSuccess.IsZero() {
+		success := c.lastSuccess
+		age := now.Sub(success).Seconds()
+		s.LastSuccess = &success
+		s.AgeSeconds = &age
+	}
+	if !c.lastFailure.IsZero() {
+		failure := c.lastFailure
+		s.LastFailure = &failure
+	}
+
+	// Probes are unhealthy when the last probe failed, self-reporting components once they are stale
+	switch {
+	case check != nil:
+		s.Healthy = c.lastError == ""
+	case c.staleAfter > 0:
+		since := c.lastSuccess
+		if since.IsZero() {
+			since = c.registeredAt
+		}
+		s.Healthy = now.Sub(since) <= c.staleAfter
+	}
+	return s
+}
+
+// Check evaluates every component, the report is unavailable when a critical one is unhealthy
+func Check(ctx context.Context) Report {
+	mu.Lock()
+	list := make([]*Component, 0, len(components))
+	for _, c := range components {
+		list = append(list, c)
+	}
+	mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	now := time.Now()
+	report := Report{Status: "ok", Time: now, Components: []ComponentStatus{}}
+	for _, c := range list {
+		s := c.status(ctx, now)
+		if s.Critical && !s.Healthy {
+			report.Status = "unavailable"
+		}
+		report.Components = append(report.Components, s)
+	}
+	return report
+}
+
+// LivenessHandler answers 200 as long as the process serves HTTP, the body carries the component details
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Check(r.Context()), http.StatusOK)
+	})
+}
+
+// ReadinessHandler answers 503 when a critical component is unhealthy
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := Check(r.Context())
+		code := http.StatusOK
+		if report.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		writeReport(w, report, code)
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
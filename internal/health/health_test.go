@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// isolate gives the test an empty registry
+func isolate(t *testing.T) {
+	mu.Lock()
+	saved := components
+	components = map[string]*Component{}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		components = saved
+		mu.Unlock()
+	})
+}
+
+func TestStaleness(t *testing.T) {
+	isolate(t)
+	c := Register("host", true, time.Minute)
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		success bool // Report a success before the check
+		at      time.Duration
+		healthy bool
+	}{
+		{"fresh registration", false, 0, true},
+		{"never succeeded", false, 2 * time.Minute, false},
+		{"recent success", true, 30 * time.Second, true},
+		{"success went stale", false, 2 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		if tt.success {
+			c.Success()
+		}
+		s := c.status(context.Background(), start.Add(tt.at))
+		if s.Healthy != tt.healthy {
+			t.Errorf("%s: healthy %v, want %v", tt.name, s.Healthy, tt.healthy)
+		}
+	}
+
+	// A failure alone doesn't make a fresh component unhealthy, staleness does
+	c.Failure(errors.New("proc unreadable"))
+	if s := c.status(context.Background(), time.Now()); !s.Healthy || s.LastError != "proc unreadable" || s.LastFailure == nil {
+		t.Errorf("after a failure got %+v", s)
+	}
+
+	// Without staleAfter a component never goes stale
+	if s := Register("backfill", false, 0).status(context.Background(), start.Add(24*time.Hour)); !s.Healthy {
+		t.Error("backfill went stale")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		critical bool
+		probe    error
+		want     string
+	}{
+		{"critical probe up", true, nil, "ok"},
+		{"critical probe down", true, down, "unavailable"},
+		{"non-critical probe down", false, down, "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			Register("userstream", true, time.Hour).Success()
+			RegisterCheck("host-db", tt.critical, func(ctx context.Context) error { return tt.probe })
+
+			report := Check(context.Background())
+			if report.Status != tt.want || len(report.Components) != 2 {
+				t.Fatalf("got %+v, want status %s", report, tt.want)
+			}
+			db := report.Components[0]
+			if db.Name != "host-db" || db.Healthy != (tt.probe == nil) || db.Critical != tt.critical {
+				t.Errorf("got %+v", db)
+			}
+		})
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	isolate(t)
+	stopped := RegisterCheck("host-db", true, func(ctx context.Context) error { return errors.New("sql: database is closed") })
+	stopped.Unregister()
+	if report := Check(context.Background()); report.Status != "ok" || len(report.Components) != 0 {
+		t.Fatalf("got %+v after the component stopped", report)
+	}
+
+	// The restarted component's probe outlives a late unregister of the old one
+	restarted := RegisterCheck("host-db", true, func(ctx context.Context) error { return nil })
+	stopped.Unregister()
+	if report := Check(context.Background()); len(report.Components) != 1 {
+		t.Errorf("got %+v, want the restarted probe", report)
+	}
+	restarted.Unregister()
+}
+
+func TestHandlers(t *testing.T) {
+	isolate(t)
+	probe := errors.New("connection refused")
+	RegisterCheck("host-db", true, func(ctx context.Context) error { return probe })
+	status := Register("backfill", false, 0)
+	status.Set("last_run_outcome", "success")
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		probe   error
+		code    int
+		status  string
+	}{
+		{"liveness while the database is down", LivenessHandler(), probe, http.StatusOK, "unavailable"},
+		{"readiness while the database is down", ReadinessHandler(), probe, http.StatusServiceUnavailable, "unavailable"},
+		{"readiness", ReadinessHandler(), nil, http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe = tt.probe
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var report Report
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.code || report.Status != tt.status || rec.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got %d %s, want %d %s", rec.Code, report.Status, tt.code, tt.status)
+			}
+			if len(report.Components) != 2 || report.Components[0].Details["last_run_outcome"] != "success" {
+				t.Errorf("components %+v", report.Components)
+			}
+		})
+	}
+}
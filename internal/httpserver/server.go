@@ -0,0 +1,58 @@
+// Package httpserver exposes the operational endpoints of a vqm process.
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/health"
+	"vector-quant-monitor/internal/metrics"
+	"vector-quant-monitor/util"
+)
+
+const shutdownTimeout = 3 * time.Second
+
+func NewMux(cfg config.HTTPConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /healthz", health.LivenessHandler())
+	mux.Handle("GET /readyz", health.ReadinessHandler())
+	mux.Handle("/loglevel", util.LevelHandler(cfg.LogLevelChanges))
+	return mux
+}
+
+// Serve listens on addr until ctx is cancelled
+func Serve(ctx context.Context, addr string, handler http.Handler, log *slog.Logger) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info(fmt.Sprintf("HTTP server listening on %s", addr))
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
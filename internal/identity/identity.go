@@ -0,0 +1,158 @@
+// Package identity works out which machine the monitor runs on, so metrics of
+// several hosts don't end up in one series.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+)
+
+// Identity names the host in every metric row
+type Identity struct {
+	Name             string // resource column: override, EC2 Name tag, instance id or hostname
+	Hostname         string
+	InstanceID       string
+	InstanceType     string
+	AvailabilityZone string
+	Region           string
+	Labels           map[string]string
+}
+
+// Discover resolves the identity from the config, IMDS and the hostname. It
+// never fails, a host outside EC2 simply ends up with its hostname.
+func Discover(ctx context.Context, cfg config.HostConfig, log *slog.Logger) Identity {
+	id := Identity{Labels: cfg.Labels}
+	if id.Labels == nil {
+		id.Labels = map[string]string{}
+	}
+
+	// 1. HOSTNAME, inside Docker this is the container id unless --hostname is set
+	id.Hostname, _ = os.Hostname()
+
+	// 2. EC2 INSTANCE METADATA
+	var nameTag string
+	if cfg.IMDSEndpoint != "" {
+		imds := NewIMDSClient(cfg.IMDSEndpoint)
+		metadata, err := imds.Metadata(ctx)
+		if err != nil {
+			log.Info(fmt.Sprintf("EC2 instance metadata not available: %v", err))
+		} else {
+			id.InstanceID = metadata.InstanceID
+			id.InstanceType = metadata.InstanceType
+			id.AvailabilityZone = metadata.AvailabilityZone
+			id.Region = metadata.Region
+			nameTag = metadata.NameTag
+		}
+	}
+
+	// 3. NAME, the first one that is set wins
+	for _, name := range []string{cfg.Name, nameTag, id.InstanceID, id.Hostname, "unknown-host"} {
+		if name != "" {
+			id.Name = name
+			break
+		}
+	}
+
+	log.Info(fmt.Sprintf("Host identity: %s (hostname %s, instance %s, labels %v)",
+		id.Name, id.Hostname, orNone(id.InstanceID), id.Labels))
+	return id
+}
+
+// IMDSClient reads EC2 instance metadata with IMDSv2 session tokens
+type IMDSClient struct {
+	Endpoint string
+	client   *http.Client
+}
+
+type IMDSMetadata struct {
+	InstanceID       string
+	InstanceType     string
+	AvailabilityZone string
+	Region           string
+	NameTag          string // Only when instance tags are allowed in the metadata
+}
+
+func NewIMDSClient(endpoint string) *IMDSClient {
+	return &IMDSClient{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		// The link-local address doesn't answer outside EC2, don't hold up the start for long
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+func (c *IMDSClient) Metadata(ctx context.Context) (IMDSMetadata, error) {
+	var m IMDSMetadata
+
+	token, err := c.token(ctx)
+	if err != nil {
+		return m, err
+	}
+
+	fields := []struct {
+		path   string
+		target *string
+	}{
+		{"instance-id", &m.InstanceID},
+		{"instance-type", &m.InstanceType},
+		{"placement/availability-zone", &m.AvailabilityZone},
+		{"placement/region", &m.Region},
+	}
+	for _, f := range fields {
+		if *f.target, err = c.get(ctx, token, f.path); err != nil {
+			return m, err
+		}
+	}
+
+	// 404 unless "Allow tags in instance metadata" is enabled
+	m.NameTag, _ = c.get(ctx, token, "tags/instance/Name")
+	return m, nil
+}
+
+func (c *IMDSClient) token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.Endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	return c.do(req)
+}
+
+func (c *IMDSClient) get(ctx context.Context, token string, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+"/latest/meta-data/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return c.do(req)
+}
+
+func (c *IMDSClient) do(req *http.Request) (string, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IMDS %s %s returned %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package identity
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"vector-quant-monitor/internal/config"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// imdsStub answers like IMDSv2: a token from PUT, metadata only with that token
+func imdsStub(t *testing.T, metadata map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, "token-1")
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		value, ok := metadata[strings.TrimPrefix(r.URL.Path, "/latest/meta-data/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, value+"\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+var ec2Metadata = map[string]string{
+	"instance-id":                 "i-0123456789abcdef0",
+	"instance-type":               "t3.small",
+	"placement/availability-zone": "eu-west-1a",
+	"placement/region":            "eu-west-1",
+}
+
+func TestDiscover(t *testing.T) {
+	hostname, _ := os.Hostname()
+	withName := map[string]string{"tags/instance/Name": "bot-prod"}
+	for k, v := range ec2Metadata {
+		withName[k] = v
+	}
+	refusing := httptest.NewServer(http.NotFoundHandler())
+	defer refusing.Close()
+
+	tests := []struct {
+		name     string
+		cfg      config.HostConfig
+		metadata map[string]string // nil for no IMDS at all
+		wantName string
+		wantID   string
+	}{
+		{"name tag", config.HostConfig{}, withName, "bot-prod", "i-0123456789abcdef0"},
+		{"instance id without tags in metadata", config.HostConfig{}, ec2Metadata, "i-0123456789abcdef0", "i-0123456789abcdef0"},
+		{"override", config.HostConfig{Name: "custom"}, withName, "custom", "i-0123456789abcdef0"},
+		{"IMDS not configured", config.HostConfig{}, nil, hostname, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if tt.metadata != nil {
+				cfg.IMDSEndpoint = imdsStub(t, tt.metadata).URL + "/"
+			}
+			id := Discover(context.Background(), cfg, discard)
+			if id.Name != tt.wantName || id.InstanceID != tt.wantID || id.Hostname != hostname {
+				t.Errorf("got %+v, want name %q and instance %q", id, tt.wantName, tt.wantID)
+			}
+			if tt.wantID != "" && (id.InstanceType != "t3.small" || id.AvailabilityZone != "eu-west-1a" || id.Region != "eu-west-1") {
+				t.Errorf("instance details %+v", id)
+			}
+			if id.Labels == nil {
+				t.Error("labels are nil")
+			}
+		})
+	}
+
+	t.Run("token refused", func(t *testing.T) {
+		id := Discover(context.Background(), config.HostConfig{IMDSEndpoint: refusing.URL}, discard)
+		if id.Name != hostname || id.InstanceID != "" {
+			t.Errorf("got %+v, want the hostname", id)
+		}
+	})
+}
+
+func TestIMDSMetadataErrors(t *testing.T) {
+	// A metadata path missing is an error, only the Name tag is optional
+	partial := map[string]string{"instance-id": "i-1"}
+	_, err := NewIMDSClient(imdsStub(t, partial).URL).Metadata(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "instance-type") {
+		t.Errorf("got %v, want the missing instance-type", err)
+	}
+}
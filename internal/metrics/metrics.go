@@ -0,0 +1,217 @@
+// Package metrics is a small Prometheus text exposition registry. Packages
+// declare their metrics as package variables and the HTTP server exposes
+// Default on /metrics.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// Default is the registry the New* functions register into
+var Default = &Registry{}
+
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // per bucket, histograms only
+	sum         float64
+	count       uint64
+}
+
+type Counter struct{ f *family }
+type Gauge struct{ f *family }
+type Histogram struct{ f *family }
+
+// DefBuckets suits durations in seconds from milliseconds up to a minute
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{Default.register(name, help, "counter", labels, nil)}
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{Default.register(name, help, "gauge", labels, nil)}
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{Default.register(name, help, "histogram", labels, sorted)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add ignores negative values, counters only go up
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.with(labelValues, func(s *series) { s.value += v })
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.with(labelValues, func(s *series) { s.value = v })
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.with(labelValues, func(s *series) {
+		if len(s.counts) != len(h.f.buckets) {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, upper := range h.f.buckets {
+			if v <= upper {
+				s.counts[i]++
+			}
+		}
+		s.sum += v
+		s.count++
+	})
+}
+
+func (r *Registry) register(name string, help string, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metrics: %s registered twice", name))
+		}
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families = append(r.families, f)
+
+	// Unlabelled series are exported as 0 before their first update
+	if len(labels) == 0 {
+		f.with(nil, func(s *series) { s.counts = make([]uint64, len(buckets)) })
+	}
+	return f
+}
+
+func (f *family) with(labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// WriteText renders every family in the Prometheus text exposition format (version 0.0.4)
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var b strings.Builder
+	for _, f := range families {
+		f.mu.Lock()
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatFloat(s.value))
+				continue
+			}
+			for i, upper := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name,
+					formatLabels(f.labels, s.labelValues, "le", formatFloat(upper)), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name,
+				formatLabels(f.labels, s.labelValues, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), s.count)
+		}
+		f.mu.Unlock()
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the Default registry
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WriteText(w)
+	})
+}
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := &Registry{}
+	events := &Counter{r.register("vqm_userstream_events_total", "User-stream events by type.", "counter", []string{"event"}, nil)}
+	accuracy := &Gauge{r.register("vqm_naive_check_accuracy", "Accuracy of the last check,\nby predictor \\ target.", "gauge", []string{"predictor", "target"}, nil)}
+	lastRun := &Gauge{r.register("vqm_naive_check_last_run", "Unix time of the last check.", "gauge", nil, nil)}
+	duration := &Histogram{r.register("vqm_backfill_run_duration_seconds", "Backfill run duration.", "histogram", nil, []float64{0.5, 1, 10})}
+	latency := &Histogram{r.register("vqm_binance_request_seconds", "Binance API latency.", "histogram", []string{"path"}, []float64{0.1, 1})}
+
+	events.Inc("ORDER_TRADE_UPDATE")
+	events.Add(2, "ACCOUNT_UPDATE")
+	events.Add(-5, "ACCOUNT_UPDATE") // Ignored, counters only go up
+	accuracy.Set(0.5, `kernel "v2"`, "next_return")
+	accuracy.Set(0.25, "line\nbreak", `C:\path`)
+	accuracy.Set(math.NaN(), "cutoff", "next_slope_5")
+	duration.Observe(0.2)
+	duration.Observe(1)
+	duration.Observe(42)
+	latency.Observe(0.05, "/fapi/v1/income")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP vqm_backfill_run_duration_seconds Backfill run duration.
+# TYPE vqm_backfill_run_duration_seconds histogram
+vqm_backfill_run_duration_seconds_bucket{le="0.5"} 1
+vqm_backfill_run_duration_seconds_bucket{le="1"} 2
+vqm_backfill_run_duration_seconds_bucket{le="10"} 2
+vqm_backfill_run_duration_seconds_bucket{le="+Inf"} 3
+vqm_backfill_run_duration_seconds_sum 43.2
+vqm_backfill_run_duration_seconds_count 3
+# HELP vqm_binance_request_seconds Binance API latency.
+# TYPE vqm_binance_request_seconds histogram
+vqm_binance_request_seconds_bucket{path="/fapi/v1/income",le="0.1"} 1
+vqm_binance_request_seconds_bucket{path="/fapi/v1/income",le="1"} 1
+vqm_binance_request_seconds_bucket{path="/fapi/v1/income",le="+Inf"} 1
+vqm_binance_request_seconds_sum{path="/fapi/v1/income"} 0.05
+vqm_binance_request_seconds_count{path="/fapi/v1/income"} 1
+# HELP vqm_naive_check_accuracy Accuracy of the last check,\nby predictor \\ target.
+# TYPE vqm_naive_check_accuracy gauge
+vqm_naive_check_accuracy{predictor="cutoff",target="next_slope_5"} NaN
+vqm_naive_check_accuracy{predictor="kernel \"v2\"",target="next_return"} 0.5
+vqm_naive_check_accuracy{predictor="line\nbreak",target="C:\\path"} 0.25
+# HELP vqm_naive_check_last_run Unix time of the last check.
+# TYPE vqm_naive_check_last_run gauge
+vqm_naive_check_last_run 0
+# HELP vqm_userstream_events_total User-stream events by type.
+# TYPE vqm_userstream_events_total counter
+vqm_userstream_events_total{event="ACCOUNT_UPDATE"} 2
+vqm_userstream_events_total{event="ORDER_TRADE_UPDATE"} 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	lastRun.Set(1.7e9)
+	b.Reset()
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), "\nvqm_naive_check_last_run 1.7e+09\n") {
+		t.Errorf("last run not updated in\n%s", b.String())
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	r := &Registry{}
+	gauge := &Gauge{r.register("vqm_host_cpu_percent", "CPU usage.", "gauge", []string{"resource"}, nil)}
+
+	for name, fn := range map[string]func(){
+		"registered twice": func() { r.register("vqm_host_cpu_percent", "CPU usage.", "gauge", nil, nil) },
+		"missing label":    func() { gauge.Set(1) },
+		"extra label":      func() { gauge.Set(1, "bot-1", "eu-west-1") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("content type %q", ct)
+	}
+}
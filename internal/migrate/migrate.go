@@ -0,0 +1,247 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Arbitrary key so two processes never migrate at the same time
+const advisoryLockKey = 72150731
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db   *sql.DB
+	log  *slog.Logger
+	vars map[string]string
+}
+
+// NewMigrator takes the values of the {{PLACEHOLDER}}s used in the SQL files
+func NewMigrator(db *sql.DB, vars map[string]string, log *slog.Logger) *Migrator {
+	return &Migrator{db: db, vars: vars, log: log}
+}
+
+// Load reads the embedded NNNN_name.up.sql / NNNN_name.down.sql pairs in version order
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named NNNN_name.%s.sql", name, direction)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has invalid version: %w", name, err)
+		}
+
+		body, err := files.ReadFile("sql/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		migrations, applied, err := m.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			m.log.Info(fmt.Sprintf("Applying migration %04d_%s", mig.Version, mig.Name))
+			err := m.apply(ctx, conn, mig.Up,
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, current_timestamp)`,
+				mig.Version, mig.Name,
+			)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		migrations, applied, err := m.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			m.log.Info(fmt.Sprintf("Reverting migration %04d_%s", mig.Version, mig.Name))
+			err := m.apply(ctx, conn, mig.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`,
+				mig.Version,
+			)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		migrations, applied, err := m.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			appliedAt, ok := applied[mig.Version]
+			statuses = append(statuses, MigrationStatus{Migration: mig, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// apply runs a migration body and its bookkeeping statement in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, body string, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.render(body)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) render(body string) string {
+	for key, value := range m.vars {
+		body = strings.ReplaceAll(body, "{{"+key+"}}", value)
+	}
+	return body
+}
+
+func (m *Migrator) state(ctx context.Context, conn *sql.Conn) ([]Migration, map[int]time.Time, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY
+			, name TEXT NOT NULL
+			, applied_at TIMESTAMPTZ NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return migrations, applied, rows.Err()
+}
+
+// withLock pins one connection so the session level advisory lock covers all statements
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+
+	return fn(conn)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS system_metric (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, resource TEXT NOT NULL
+	, cpu_pct DOUBLE PRECISION
+	, mem_pct DOUBLE PRECISION
+	, disk_pct DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS system_metric_resource_recorded_at_idx
+	ON system_metric (resource, recorded_at DESC);
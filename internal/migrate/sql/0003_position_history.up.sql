@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS trading.position_history (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, market TEXT NOT NULL
+	, symbol TEXT NOT NULL
+	, side TEXT NOT NULL
+	, net_pnl DOUBLE PRECISION
+	, volume DOUBLE PRECISION
+	, open_timestamp TIMESTAMPTZ NOT NULL
+	, close_timestamp TIMESTAMPTZ NOT NULL
+);
+
+-- InsertPositionHistory relies on ON CONFLICT (open_timestamp, symbol)
+CREATE UNIQUE INDEX IF NOT EXISTS position_history_open_timestamp_symbol_key
+	ON trading.position_history (open_timestamp, symbol);
+
+CREATE INDEX IF NOT EXISTS position_history_close_timestamp_idx
+	ON trading.position_history (close_timestamp DESC);
@@ -0,0 +1,6 @@
+ALTER TABLE trading.position_history
+	DROP COLUMN IF EXISTS gross_pnl
+	, DROP COLUMN IF EXISTS fees
+	, DROP COLUMN IF EXISTS funding
+	, DROP COLUMN IF EXISTS avg_entry_price
+	, DROP COLUMN IF EXISTS avg_exit_price;
@@ -0,0 +1,9 @@
+-- market used to be written as 0, it now carries an identifier like BINANCE_USDM_FUTURES
+ALTER TABLE trading.position_history ALTER COLUMN market TYPE TEXT USING market::text;
+
+ALTER TABLE trading.position_history
+	ADD COLUMN IF NOT EXISTS gross_pnl DOUBLE PRECISION
+	, ADD COLUMN IF NOT EXISTS fees DOUBLE PRECISION
+	, ADD COLUMN IF NOT EXISTS funding DOUBLE PRECISION
+	, ADD COLUMN IF NOT EXISTS avg_entry_price DOUBLE PRECISION
+	, ADD COLUMN IF NOT EXISTS avg_exit_price DOUBLE PRECISION;
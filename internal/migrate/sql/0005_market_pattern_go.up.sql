@@ -0,0 +1,29 @@
+-- The pattern table is produced by the embedding job, it is only created here
+-- on a fresh database. The placeholder in braces is replaced with the EMBEDDING_DIM setting.
+DO $$
+BEGIN
+	IF to_regclass('market_pattern_go') IS NULL THEN
+		IF {{EMBEDDING_DIM}} <= 0 THEN
+			RAISE EXCEPTION 'market_pattern_go does not exist, set EMBEDDING_DIM to create it';
+		END IF;
+
+		CREATE TABLE market_pattern_go (
+			time BIGINT NOT NULL -- candle open, unix seconds
+			, symbol TEXT NOT NULL
+			, interval TEXT NOT NULL
+			, close_price DOUBLE PRECISION
+			, next_return DOUBLE PRECISION
+			, next_slope_3 DOUBLE PRECISION
+			, next_slope_5 DOUBLE PRECISION
+			, embedding vector({{EMBEDDING_DIM}}) NOT NULL
+		);
+	END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS market_pattern_go_symbol_interval_time_key
+	ON market_pattern_go (symbol, interval, time);
+
+-- The naive check orders by cosine distance (<=>)
+CREATE INDEX IF NOT EXISTS market_pattern_go_embedding_hnsw_idx
+	ON market_pattern_go USING hnsw (embedding vector_cosine_ops);
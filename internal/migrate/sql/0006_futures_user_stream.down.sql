@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS trading.futures_stream_gap;
+DROP TABLE IF EXISTS trading.futures_user_event;
+DROP TABLE IF EXISTS trading.futures_account_config_update;
+DROP TABLE IF EXISTS trading.futures_margin_call;
+DROP TABLE IF EXISTS trading.futures_position_update;
+DROP TABLE IF EXISTS trading.futures_balance_update;
+DROP TABLE IF EXISTS trading.futures_order_update;
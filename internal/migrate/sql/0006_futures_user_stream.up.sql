@@ -0,0 +1,93 @@
+CREATE TABLE IF NOT EXISTS trading.futures_order_update (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, order_id BIGINT NOT NULL
+	, trade_id BIGINT NOT NULL
+	, event_time TIMESTAMPTZ NOT NULL
+	, trade_time TIMESTAMPTZ
+	, symbol TEXT NOT NULL
+	, client_order_id TEXT
+	, side TEXT
+	, position_side TEXT
+	, order_type TEXT
+	, execution_type TEXT
+	, status TEXT
+	, orig_qty DOUBLE PRECISION
+	, orig_price DOUBLE PRECISION
+	, avg_price DOUBLE PRECISION
+	, last_filled_qty DOUBLE PRECISION
+	, last_filled_price DOUBLE PRECISION
+	, accumulated_qty DOUBLE PRECISION
+	, commission DOUBLE PRECISION
+	, commission_asset TEXT
+	, realized_pnl DOUBLE PRECISION
+	, is_maker BOOLEAN
+	, reduce_only BOOLEAN
+	, CONSTRAINT futures_order_update_key UNIQUE (order_id, trade_id, event_time)
+);
+
+CREATE TABLE IF NOT EXISTS trading.futures_balance_update (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, event_time TIMESTAMPTZ NOT NULL
+	, transaction_time TIMESTAMPTZ
+	, reason TEXT
+	, asset TEXT NOT NULL
+	, wallet_balance DOUBLE PRECISION
+	, cross_wallet_balance DOUBLE PRECISION
+	, balance_change DOUBLE PRECISION
+	, CONSTRAINT futures_balance_update_key UNIQUE (event_time, asset)
+);
+
+CREATE TABLE IF NOT EXISTS trading.futures_position_update (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, event_time TIMESTAMPTZ NOT NULL
+	, transaction_time TIMESTAMPTZ
+	, reason TEXT
+	, symbol TEXT NOT NULL
+	, position_side TEXT NOT NULL
+	, position_amt DOUBLE PRECISION
+	, entry_price DOUBLE PRECISION
+	, unrealized_pnl DOUBLE PRECISION
+	, margin_type TEXT
+	, isolated_wallet DOUBLE PRECISION
+	, CONSTRAINT futures_position_update_key UNIQUE (event_time, symbol, position_side)
+);
+
+CREATE TABLE IF NOT EXISTS trading.futures_margin_call (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, event_time TIMESTAMPTZ NOT NULL
+	, cross_wallet_balance DOUBLE PRECISION
+	, symbol TEXT NOT NULL
+	, position_side TEXT NOT NULL
+	, position_amt DOUBLE PRECISION
+	, margin_type TEXT
+	, isolated_wallet DOUBLE PRECISION
+	, mark_price DOUBLE PRECISION
+	, unrealized_pnl DOUBLE PRECISION
+	, maint_margin DOUBLE PRECISION
+	, CONSTRAINT futures_margin_call_key UNIQUE (event_time, symbol, position_side)
+);
+
+CREATE TABLE IF NOT EXISTS trading.futures_account_config_update (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, event_time TIMESTAMPTZ NOT NULL
+	, symbol TEXT NOT NULL
+	, leverage BIGINT
+	, CONSTRAINT futures_account_config_update_key UNIQUE (event_time, symbol)
+);
+
+CREATE TABLE IF NOT EXISTS trading.futures_user_event (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, event_type TEXT NOT NULL
+	, event_time TIMESTAMPTZ NOT NULL
+	, payload_hash TEXT NOT NULL
+	, payload JSONB
+	, CONSTRAINT futures_user_event_key UNIQUE (event_type, event_time, payload_hash)
+);
+
+CREATE TABLE IF NOT EXISTS trading.futures_stream_gap (
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, gap_start TIMESTAMPTZ NOT NULL
+	, gap_end TIMESTAMPTZ NOT NULL
+	, reason TEXT
+	, CONSTRAINT futures_stream_gap_key UNIQUE (gap_start)
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS host_process;
+DROP TABLE IF EXISTS host_filesystem;
+DROP TABLE IF EXISTS host_disk_io;
+DROP TABLE IF EXISTS host_network;
+DROP TABLE IF EXISTS host_cpu_core;
+DROP TABLE IF EXISTS host_system;
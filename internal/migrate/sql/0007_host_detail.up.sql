@@ -0,0 +1,88 @@
+-- Detailed host samples, one row per entity and tick. Rates are per second
+-- over the sampling interval, the first tick after a start has none.
+
+CREATE TABLE IF NOT EXISTS host_system (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, load1 DOUBLE PRECISION
+	, load5 DOUBLE PRECISION
+	, load15 DOUBLE PRECISION
+	, swap_total_bytes BIGINT
+	, swap_used_bytes BIGINT
+	, swap_pct DOUBLE PRECISION
+	, process_count INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS host_system_resource_recorded_at_idx
+	ON host_system (resource, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS host_cpu_core (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, core INTEGER NOT NULL
+	, cpu_pct DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS host_cpu_core_resource_recorded_at_idx
+	ON host_cpu_core (resource, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS host_network (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, interface TEXT NOT NULL
+	, rx_bytes_per_sec DOUBLE PRECISION
+	, tx_bytes_per_sec DOUBLE PRECISION
+	, rx_packets_per_sec DOUBLE PRECISION
+	, tx_packets_per_sec DOUBLE PRECISION
+	, rx_errors BIGINT -- Since the previous sample
+	, tx_errors BIGINT
+	, rx_dropped BIGINT
+	, tx_dropped BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS host_network_resource_recorded_at_idx
+	ON host_network (resource, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS host_disk_io (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, device TEXT NOT NULL
+	, read_bytes_per_sec DOUBLE PRECISION
+	, write_bytes_per_sec DOUBLE PRECISION
+	, read_ops_per_sec DOUBLE PRECISION
+	, write_ops_per_sec DOUBLE PRECISION
+	, busy_pct DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS host_disk_io_resource_recorded_at_idx
+	ON host_disk_io (resource, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS host_filesystem (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, mountpoint TEXT NOT NULL
+	, device TEXT
+	, fstype TEXT
+	, total_bytes BIGINT
+	, used_bytes BIGINT
+	, used_pct DOUBLE PRECISION
+	, inodes_total BIGINT
+	, inodes_used BIGINT
+	, inodes_pct DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS host_filesystem_resource_recorded_at_idx
+	ON host_filesystem (resource, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS host_process (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, pid INTEGER NOT NULL
+	, name TEXT
+	, cpu_pct DOUBLE PRECISION
+	, rss_bytes BIGINT
+	, mem_pct DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS host_process_resource_recorded_at_idx
+	ON host_process (resource, recorded_at DESC);
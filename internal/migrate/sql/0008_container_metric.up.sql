@@ -0,0 +1,22 @@
+-- Per-container samples read from cgroup v2, rates are per second over the sampling interval
+CREATE TABLE IF NOT EXISTS container_metric (
+	recorded_at TIMESTAMPTZ NOT NULL
+	, resource TEXT NOT NULL
+	, container_id TEXT NOT NULL
+	, container_name TEXT NOT NULL
+	, cpu_pct DOUBLE PRECISION -- 100 is one full core
+	, cpu_throttled_pct DOUBLE PRECISION
+	, mem_bytes BIGINT
+	, mem_limit_bytes BIGINT -- NULL when unlimited
+	, mem_pct DOUBLE PRECISION
+	, io_read_bytes_per_sec DOUBLE PRECISION
+	, io_write_bytes_per_sec DOUBLE PRECISION
+	, pids INTEGER
+	, pids_limit INTEGER -- NULL when unlimited
+);
+
+CREATE INDEX IF NOT EXISTS container_metric_resource_recorded_at_idx
+	ON container_metric (resource, recorded_at DESC);
+
+CREATE INDEX IF NOT EXISTS container_metric_container_name_recorded_at_idx
+	ON container_metric (container_name, recorded_at DESC);
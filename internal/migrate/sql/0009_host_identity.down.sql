@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS container_metric_labels_idx;
+DROP INDEX IF EXISTS system_metric_labels_idx;
+
+ALTER TABLE container_metric DROP COLUMN IF EXISTS labels;
+ALTER TABLE host_process DROP COLUMN IF EXISTS labels;
+ALTER TABLE host_filesystem DROP COLUMN IF EXISTS labels;
+ALTER TABLE host_disk_io DROP COLUMN IF EXISTS labels;
+ALTER TABLE host_network DROP COLUMN IF EXISTS labels;
+ALTER TABLE host_cpu_core DROP COLUMN IF EXISTS labels;
+ALTER TABLE host_system DROP COLUMN IF EXISTS labels;
+ALTER TABLE system_metric DROP COLUMN IF EXISTS labels;
+
+DROP TABLE IF EXISTS host_identity;
@@ -0,0 +1,25 @@
+-- One row per monitored host, resource is the value stored in every metric row
+CREATE TABLE IF NOT EXISTS host_identity (
+	resource TEXT PRIMARY KEY
+	, hostname TEXT
+	, instance_id TEXT
+	, instance_type TEXT
+	, availability_zone TEXT
+	, region TEXT
+	, labels JSONB NOT NULL DEFAULT '{}'
+	, first_seen TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, last_seen TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+-- Labels travel with every row so dashboards can filter, e.g. labels->>'environment' = 'prod'
+ALTER TABLE system_metric ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE host_system ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE host_cpu_core ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE host_network ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE host_disk_io ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE host_filesystem ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE host_process ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE container_metric ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS system_metric_labels_idx ON system_metric USING GIN (labels);
+CREATE INDEX IF NOT EXISTS container_metric_labels_idx ON container_metric USING GIN (labels);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS evaluation_prediction;
+DROP TABLE IF EXISTS evaluation_run;
@@ -0,0 +1,34 @@
+-- One row per evaluation of the kNN prediction over a range of market_pattern_go
+CREATE TABLE IF NOT EXISTS evaluation_run (
+	id BIGSERIAL PRIMARY KEY
+	, kind TEXT NOT NULL -- walk_forward
+	, started_at TIMESTAMPTZ NOT NULL
+	, finished_at TIMESTAMPTZ NOT NULL
+	, symbol TEXT NOT NULL
+	, interval TEXT NOT NULL
+	, range_from TIMESTAMPTZ NOT NULL
+	, range_to TIMESTAMPTZ NOT NULL
+	, params JSONB NOT NULL -- k, horizon, embargo, train period
+	, query_rows INTEGER NOT NULL
+	, predictions INTEGER NOT NULL -- query rows that were not a tie
+	, hit_rate DOUBLE PRECISION -- NULL without predictions
+	, coverage DOUBLE PRECISION
+	, summary JSONB NOT NULL -- confusion matrix, precision/recall, confidence buckets
+);
+
+CREATE INDEX IF NOT EXISTS evaluation_run_kind_started_at_idx
+	ON evaluation_run (kind, started_at DESC);
+
+-- Every query row of a run, direction is 1 up, -1 down and 0 for a tie
+CREATE TABLE IF NOT EXISTS evaluation_prediction (
+	run_id BIGINT NOT NULL REFERENCES evaluation_run (id) ON DELETE CASCADE
+	, time TIMESTAMPTZ NOT NULL -- candle open of the query pattern
+	, predicted SMALLINT NOT NULL
+	, actual SMALLINT NOT NULL
+	, positive_count INTEGER NOT NULL
+	, negative_count INTEGER NOT NULL
+	, num_diff_count INTEGER NOT NULL
+	, neighbors INTEGER NOT NULL
+	, next_return DOUBLE PRECISION
+	, PRIMARY KEY (run_id, time)
+);
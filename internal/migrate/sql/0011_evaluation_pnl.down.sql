@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS evaluation_equity;
+DROP TABLE IF EXISTS evaluation_pnl;
@@ -0,0 +1,31 @@
+-- Simulated trading of the predictions of an evaluation run
+CREATE TABLE IF NOT EXISTS evaluation_pnl (
+	id BIGSERIAL PRIMARY KEY
+	, run_id BIGINT NOT NULL REFERENCES evaluation_run (id) ON DELETE CASCADE
+	, created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	, leverage DOUBLE PRECISION NOT NULL
+	, fee_rate DOUBLE PRECISION NOT NULL -- Per side, fraction of the notional
+	, slippage DOUBLE PRECISION NOT NULL -- Per side, fraction of the price
+	, min_num_diff INTEGER NOT NULL -- Confidence threshold on NumDiffCount
+	, trades INTEGER NOT NULL
+	, winning_trades INTEGER NOT NULL
+	, final_equity DOUBLE PRECISION NOT NULL -- Starting from 1
+	, max_drawdown DOUBLE PRECISION NOT NULL -- Fraction of the peak equity
+	, sharpe DOUBLE PRECISION -- Annualized, NULL without variance
+	, sortino DOUBLE PRECISION
+	, fees DOUBLE PRECISION NOT NULL -- Fees and slippage paid, in starting equity
+);
+
+CREATE INDEX IF NOT EXISTS evaluation_pnl_run_id_idx
+	ON evaluation_pnl (run_id);
+
+-- Equity after every query row of the run, position is 1 long, -1 short and 0 flat
+CREATE TABLE IF NOT EXISTS evaluation_equity (
+	pnl_id BIGINT NOT NULL REFERENCES evaluation_pnl (id) ON DELETE CASCADE
+	, time TIMESTAMPTZ NOT NULL
+	, position SMALLINT NOT NULL
+	, period_return DOUBLE PRECISION NOT NULL
+	, equity DOUBLE PRECISION NOT NULL
+	, drawdown DOUBLE PRECISION NOT NULL
+	, PRIMARY KEY (pnl_id, time)
+);
@@ -0,0 +1,10 @@
+ALTER TABLE evaluation_pnl DROP COLUMN IF EXISTS predictor;
+
+DELETE FROM evaluation_prediction WHERE predictor <> 'majority';
+ALTER TABLE evaluation_prediction DROP CONSTRAINT IF EXISTS evaluation_prediction_pkey;
+ALTER TABLE evaluation_prediction ADD PRIMARY KEY (run_id, time);
+ALTER TABLE evaluation_prediction
+	DROP COLUMN IF EXISTS score
+	, DROP COLUMN IF EXISTS predictor;
+
+DROP TABLE IF EXISTS evaluation_run_predictor;
@@ -0,0 +1,24 @@
+-- A run compares several predictors on the same neighbors. evaluation_run keeps
+-- the figures of the first predictor, every predictor gets a row here.
+CREATE TABLE IF NOT EXISTS evaluation_run_predictor (
+	run_id BIGINT NOT NULL REFERENCES evaluation_run (id) ON DELETE CASCADE
+	, predictor TEXT NOT NULL -- majority, weighted, kernel, cutoff
+	, predictions INTEGER NOT NULL
+	, hit_rate DOUBLE PRECISION
+	, coverage DOUBLE PRECISION
+	, summary JSONB NOT NULL
+	, PRIMARY KEY (run_id, predictor)
+);
+
+INSERT INTO evaluation_run_predictor (run_id, predictor, predictions, hit_rate, coverage, summary)
+SELECT id, 'majority', predictions, hit_rate, coverage, summary
+FROM evaluation_run
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE evaluation_prediction
+	ADD COLUMN IF NOT EXISTS predictor TEXT NOT NULL DEFAULT 'majority'
+	, ADD COLUMN IF NOT EXISTS score DOUBLE PRECISION;
+ALTER TABLE evaluation_prediction DROP CONSTRAINT IF EXISTS evaluation_prediction_pkey;
+ALTER TABLE evaluation_prediction ADD PRIMARY KEY (run_id, predictor, time);
+
+ALTER TABLE evaluation_pnl ADD COLUMN IF NOT EXISTS predictor TEXT NOT NULL DEFAULT 'majority';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS trading.futures_stream_gap_unrepaired;
+DELETE FROM trading.futures_stream_gap WHERE gap_end IS NULL;
+ALTER TABLE trading.futures_stream_gap
+	DROP COLUMN IF EXISTS repaired_at
+	, ALTER COLUMN gap_end SET NOT NULL;
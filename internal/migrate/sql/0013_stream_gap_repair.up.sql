@@ -0,0 +1,9 @@
+-- A gap is recorded when the stream drops and closed on reconnect, gap_end
+-- stays NULL while it is still open. The backfill marks the gaps it covered.
+ALTER TABLE trading.futures_stream_gap
+	ALTER COLUMN gap_end DROP NOT NULL
+	, ADD COLUMN IF NOT EXISTS repaired_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS futures_stream_gap_unrepaired
+	ON trading.futures_stream_gap (gap_start)
+	WHERE repaired_at IS NULL;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS trading.position_history_open_timestamp_symbol_position_side_key;
+-- Of a LONG and a SHORT opened in the same millisecond only one fits the old key
+DELETE FROM trading.position_history a
+	USING trading.position_history b
+	WHERE a.open_timestamp = b.open_timestamp
+		AND a.symbol = b.symbol
+		AND a.position_side > b.position_side;
+CREATE UNIQUE INDEX IF NOT EXISTS position_history_open_timestamp_symbol_key
+	ON trading.position_history (open_timestamp, symbol);
+
+ALTER TABLE trading.position_history DROP COLUMN IF EXISTS position_side;
@@ -0,0 +1,9 @@
+-- Hedge mode keeps a LONG and a SHORT position per symbol, both can open in
+-- the same millisecond. Rows stored before are one-way mode positions.
+ALTER TABLE trading.position_history
+	ADD COLUMN IF NOT EXISTS position_side TEXT NOT NULL DEFAULT 'BOTH';
+
+-- InsertPositionHistory relies on ON CONFLICT (open_timestamp, symbol, position_side)
+DROP INDEX IF EXISTS trading.position_history_open_timestamp_symbol_key;
+CREATE UNIQUE INDEX IF NOT EXISTS position_history_open_timestamp_symbol_position_side_key
+	ON trading.position_history (open_timestamp, symbol, position_side);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS trading.position_history_close_timestamp_symbol_position_side_key;
+CREATE UNIQUE INDEX IF NOT EXISTS position_history_open_timestamp_symbol_position_side_key
+	ON trading.position_history (open_timestamp, symbol, position_side);
@@ -0,0 +1,14 @@
+-- A position opened before the backfill window is stored with its close time
+-- as open time, a run that saw the real open would store it again. The close
+-- is the same in every window.
+DELETE FROM trading.position_history a
+	USING trading.position_history b
+	WHERE a.close_timestamp = b.close_timestamp
+		AND a.symbol = b.symbol
+		AND a.position_side = b.position_side
+		AND (a.open_timestamp, a.recorded_at) > (b.open_timestamp, b.recorded_at);
+
+-- InsertPositionHistory relies on ON CONFLICT (close_timestamp, symbol, position_side)
+DROP INDEX IF EXISTS trading.position_history_open_timestamp_symbol_position_side_key;
+CREATE UNIQUE INDEX IF NOT EXISTS position_history_close_timestamp_symbol_position_side_key
+	ON trading.position_history (close_timestamp, symbol, position_side);
@@ -2,74 +2,180 @@ package monitor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/futures"
-)
 
-func StartFuturesUserStream(apiKey, secretKey string, log *slog.Logger) {
-	// 1. Initialize Client to get the ListenKey
-	client := binance.NewFuturesClient(apiKey, secretKey)
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/health"
+)
 
-	// 2. Generate the initial ListenKey
-	// This acts like a "session ID" for the WebSocket
-	listenKey, err := client.NewStartUserStreamService().Do(context.TODO())
+func StartFuturesUserStream(ctx context.Context, config *config.AppConfig, log *slog.Logger) error {
+	store, err := db.Connect(config.Database, log)
 	if err != nil {
-		log.Info(fmt.Sprintf("Error getting ListenKey: %v", err))
-		return
+		return err
 	}
+	defer store.DB.Close()
+	// Every component pings its own connection, which closes when it stops
+	defer health.RegisterCheck("userstream-db", true, store.DB.PingContext).Unregister()
 
-	// 3. Launch "Keep-Alive" Manager (The Heartbeat)
-	// Runs in the background to prevent disconnection every 60 mins
-	go func() {
-		ticker := time.NewTicker(50 * time.Minute)
-		for range ticker.C {
-			err := client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(context.TODO())
-			if err != nil {
-				log.Info(fmt.Sprintf("Keep-alive failed: %v", err))
-			} else {
-				log.Info(fmt.Sprintln("--- 🔄 ListenKey Refreshed ---"))
-			}
-		}
-	}()
+	// Events can't be replayed from Binance, refuse to consume them without the tables
+	if err := store.CheckFuturesSchema(ctx); err != nil {
+		return err
+	}
 
-	// 4. Define the Handler (The Logic)
+	// 1. Initialize Client used for the ListenKey
+	client := binance.NewFuturesClient(config.Binance.ApiKey, config.Binance.ApiSecret)
+
+	// 2. Define the Handler (The Logic)
+	var status *health.Component
 	wsHandler := func(event *futures.WsUserDataEvent) {
-		// Handle Futures-specific events
-		switch event.Event {
-
-		// A. Position & PnL Updates (The "Risk Monitor")
-		case futures.UserDataEventTypeAccountUpdate:
-			for _, pos := range event.AccountUpdate.Positions {
-				log.Info(fmt.Sprintf("[Position] %s | PnL: %s\n", pos.Symbol, pos.UnrealizedPnL))
-			}
-
-		// B. Trade Updates (The "Fees & Fills")
-		case futures.UserDataEventTypeOrderTradeUpdate:
-			order := event.OrderTradeUpdate
-			if order.Status == "FILLED" {
-				log.Info(fmt.Sprintf("[Trade] %s Filled | Fee: %s %s\n",
-					order.Symbol, order.Commission, order.CommissionAsset))
-			}
+		userStreamEventsTotal.Inc(string(event.Event))
+		status.Set("last_event_at", time.Now())
+		status.Set("last_event_type", string(event.Event))
+		if err := persistUserDataEvent(store, event, log); err != nil {
+			userStreamPersistErrorsTotal.Inc(string(event.Event))
+			log.Info(fmt.Sprintf("Error persisting %s event: %v", event.Event, err))
 		}
 	}
 
-	errHandler := func(err error) {
-		log.Info(fmt.Sprintf("Connection Error: %v", err))
+	// 3. Supervise the connection
+	// The stream renews the ListenKey, reconnects and reports outages for the backfill
+	stream := NewUserStream(client, wsHandler, log)
+
+	// An idle account sends no events, but Binance pings within every ReadTimeout
+	status = health.Register("userstream", true, stream.ReadTimeout)
+	stream.OnActivity = status.Success
+	// The gap is on record while it lasts, the backfill repairs open and closed gaps
+	stream.OnDisconnect = func(from time.Time, reason string) {
+		if err := store.OpenStreamGap(from, reason); err != nil {
+			log.Info(fmt.Sprintf("Error recording stream gap: %v", err))
+		}
+	}
+	// Also ends the gap a previous process left open when it stopped while disconnected
+	stream.OnConnect = func(at time.Time) {
+		if err := store.CloseStreamGaps(at); err != nil {
+			log.Info(fmt.Sprintf("Error closing stream gap: %v", err))
+		}
+	}
+
+	// Block until ctx is cancelled
+	return stream.Run(ctx)
+}
+
+// persistUserDataEvent writes one user-data event to its trading.* table
+func persistUserDataEvent(store *db.Postgresql, event *futures.WsUserDataEvent, log *slog.Logger) error {
+	eventTime := time.UnixMilli(event.Time)
+
+	switch event.Event {
+
+	// A. Position & Balance Updates (The "Risk Monitor")
+	case futures.UserDataEventTypeAccountUpdate:
+		update := event.AccountUpdate
+		for _, pos := range update.Positions {
+			log.Info(fmt.Sprintf("[Position] %s | PnL: %s", pos.Symbol, pos.UnrealizedPnL))
+		}
+		row := db.FuturesAccountUpdate{
+			EventTime:       eventTime,
+			TransactionTime: time.UnixMilli(event.TransactionTime),
+			Reason:          string(update.Reason),
+		}
+		for _, b := range update.Balances {
+			row.Balances = append(row.Balances, db.FuturesBalance{
+				Asset:              b.Asset,
+				WalletBalance:      parseFloat(b.Balance),
+				CrossWalletBalance: parseFloat(b.CrossWalletBalance),
+				BalanceChange:      parseFloat(b.ChangeBalance),
+			})
+		}
+		for _, pos := range update.Positions {
+			row.Positions = append(row.Positions, toPositionRow(pos))
+		}
+		return store.InsertFuturesAccountUpdate(row)
+
+	// B. Order Updates (The "Fees & Fills"), including partial fills, cancels and expiries
+	case futures.UserDataEventTypeOrderTradeUpdate:
+		order := event.OrderTradeUpdate
+		if order.Status == futures.OrderStatusTypeFilled {
+			log.Info(fmt.Sprintf("[Trade] %s Filled | Fee: %s %s",
+				order.Symbol, order.Commission, order.CommissionAsset))
+		}
+		return store.InsertFuturesOrderUpdate(db.FuturesOrderUpdate{
+			OrderID:         order.ID,
+			TradeID:         order.TradeID,
+			EventTime:       eventTime,
+			TradeTime:       time.UnixMilli(order.TradeTime),
+			Symbol:          order.Symbol,
+			ClientOrderID:   order.ClientOrderID,
+			Side:            string(order.Side),
+			PositionSide:    string(order.PositionSide),
+			OrderType:       string(order.Type),
+			ExecutionType:   string(order.ExecutionType),
+			Status:          string(order.Status),
+			OrigQty:         parseFloat(order.OriginalQty),
+			OrigPrice:       parseFloat(order.OriginalPrice),
+			AvgPrice:        parseFloat(order.AveragePrice),
+			LastFilledQty:   parseFloat(order.LastFilledQty),
+			LastFilledPrice: parseFloat(order.LastFilledPrice),
+			AccumulatedQty:  parseFloat(order.AccumulatedFilledQty),
+			Commission:      parseFloat(order.Commission),
+			CommissionAsset: order.CommissionAsset,
+			RealizedPnl:     parseFloat(order.RealizedPnL),
+			IsMaker:         order.IsMaker,
+			ReduceOnly:      order.IsReduceOnly,
+		})
+
+	// C. Margin Calls
+	case futures.UserDataEventTypeMarginCall:
+		log.Info(fmt.Sprintf("[MarginCall] %d positions at risk", len(event.MarginCallPositions)))
+		row := db.FuturesMarginCall{
+			EventTime:          eventTime,
+			CrossWalletBalance: parseFloat(event.CrossWalletBalance),
+		}
+		for _, pos := range event.MarginCallPositions {
+			row.Positions = append(row.Positions, toPositionRow(pos))
+		}
+		return store.InsertFuturesMarginCall(row)
+
+	// D. Leverage changes
+	case futures.UserDataEventTypeAccountConfigUpdate:
+		cfg := event.AccountConfigUpdate
+		if cfg.Symbol == "" {
+			break
+		}
+		return store.InsertFuturesAccountConfigUpdate(eventTime, cfg.Symbol, cfg.Leverage)
 	}
 
-	// 5. Connect
-	// Note: We pass the 'listenKey' we generated in step 2
-	doneC, stopC, err := futures.WsUserDataServe(listenKey, wsHandler, errHandler)
+	// Everything else is kept as raw JSON so nothing is lost
+	payload, err := json.Marshal(event)
 	if err != nil {
-		log.Info(fmt.Sprintf("Could not connect: %v", err))
-		return
+		return err
 	}
+	return store.InsertFuturesRawEvent(string(event.Event), eventTime, payload)
+}
+
+func toPositionRow(pos futures.WsPosition) db.FuturesPosition {
+	return db.FuturesPosition{
+		Symbol:         pos.Symbol,
+		PositionSide:   string(pos.Side),
+		PositionAmt:    parseFloat(pos.Amount),
+		EntryPrice:     parseFloat(pos.EntryPrice),
+		MarkPrice:      parseFloat(pos.MarkPrice),
+		UnrealizedPnl:  parseFloat(pos.UnrealizedPnL),
+		MarginType:     string(pos.MarginType),
+		IsolatedWallet: parseFloat(pos.IsolatedWallet),
+		MaintMargin:    parseFloat(pos.MaintenanceMarginRequired),
+	}
+}
 
-	// Block forever (or until disconnected)
-	<-doneC
-	close(stopC)
+// Binance sends numbers as strings, missing values are treated as zero
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
 }
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"vector-quant-monitor/internal/batch"
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+)
+
+// bufferedStore queues every insert on a batch.Writer, which batches them and
+// spools them to disk while Postgres is unreachable. Each batch is written in
+// one transaction, so a replayed batch never duplicates part of itself.
+// Inserts queue the records and return the writer's last flush error, the
+// monitors count and report it as they would a direct insert failure.
+type bufferedStore struct {
+	metrics    *batch.Writer[db.HostMetric]
+	details    *batch.Writer[db.HostDetailRecord]
+	containers *batch.Writer[db.ContainerRecord]
+}
+
+func newBufferedStore(store db.SampleBatchStore, cfg config.WorkerConfig, log *slog.Logger) *bufferedStore {
+	b := &bufferedStore{
+		metrics:    batch.NewWriter("system_metric", cfg.MetricSpoolDir, store.InsertHostMetrics, log),
+		details:    batch.NewWriter("host_detail", cfg.MetricSpoolDir, store.InsertHostDetails, log),
+		containers: batch.NewWriter("container_metric", cfg.MetricSpoolDir, store.InsertContainerRecords, log),
+	}
+
+	batchSize := max(cfg.MetricBatchSize, 1)
+	flushInterval := time.Duration(max(cfg.MetricFlushIntervalSeconds, 1)) * time.Second
+	b.metrics.BatchSize, b.metrics.FlushInterval = batchSize, flushInterval
+	b.details.BatchSize, b.details.FlushInterval = batchSize, flushInterval
+	b.containers.BatchSize, b.containers.FlushInterval = batchSize, flushInterval
+	return b
+}
+
+// run starts the writers, the returned channel is closed once all of them flushed after ctx is cancelled
+func (b *bufferedStore) run(ctx context.Context) <-chan struct{} {
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context) error{b.metrics.Run, b.details.Run, b.containers.Run} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (b *bufferedStore) InsertHostMetrics(metrics []db.HostMetric) error {
+	for _, m := range metrics {
+		b.metrics.Add(m)
+	}
+	return b.metrics.Err()
+}
+
+func (b *bufferedStore) InsertHostDetail(host db.Host, d db.HostDetail) error {
+	b.details.Add(db.HostDetailRecord{Host: host, Detail: d})
+	return b.details.Err()
+}
+
+func (b *bufferedStore) InsertContainerMetrics(host db.Host, metrics []db.ContainerMetric) error {
+	b.containers.Add(db.ContainerRecord{Host: host, Metrics: metrics})
+	return b.containers.Err()
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+)
+
+func TestBufferedStoreReportsOutage(t *testing.T) {
+	store := db.NewMemoryStore()
+	b := newBufferedStore(store, config.WorkerConfig{MetricBatchSize: 1, MetricSpoolDir: t.TempDir()}, discard)
+	b.details.FlushInterval, b.details.MinBackoff, b.details.MaxBackoff = 10*time.Millisecond, time.Millisecond, 10*time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := b.run(ctx)
+	host := db.Host{Resource: "bot-1"}
+	insert := func(i int) error {
+		return b.InsertHostDetail(host, db.HostDetail{RecordedAt: time.Unix(int64(i), 0), ProcessCount: i})
+	}
+
+	// The outage shows up on the inserts once a flush failed
+	store.SetErr(errors.New("connection refused"))
+	inserted := 0
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		inserted++
+		if err := insert(inserted); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("inserts never reported the outage")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Back up, the spool is replayed and the inserts succeed again
+	store.SetErr(nil)
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		inserted++
+		if err := insert(inserted); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("inserts still failing after the outage")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// Every sample is stored exactly once, in order
+	if len(store.HostDetails) != inserted {
+		t.Fatalf("stored %d samples, inserted %d", len(store.HostDetails), inserted)
+	}
+	for i, d := range store.HostDetails {
+		if d.ProcessCount != i+1 {
+			t.Fatalf("sample %d is %d, want %d", i, d.ProcessCount, i+1)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"vector-quant-monitor/internal/db"
+)
+
+// Container cgroups are named after the 64 hex id, e.g. docker/<id> with the
+// cgroupfs driver or system.slice/docker-<id>.scope with the systemd driver
+var containerCgroupPattern = regexp.MustCompile(`^(?:docker-|cri-containerd-|crio-|libpod-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+// Containers live at most a few levels below the cgroup root
+const maxCgroupDepth = 4
+
+// An id the namer didn't know, e.g. from another runtime or already gone, is
+// asked for again only after this long
+const nameRetryInterval = 5 * time.Minute
+
+// ContainerNamer maps container ids to names
+type ContainerNamer interface {
+	ContainerNames(ctx context.Context) (map[string]string, error)
+}
+
+// ContainerCollector reads cgroup v2 stats of every container below
+// CgroupRoot. Inside a container mount the host's /sys/fs/cgroup and point
+// CgroupRoot at it. Rates need two samples, the first one only has gauges.
+type ContainerCollector struct {
+	CgroupRoot      string
+	Namer           ContainerNamer // Optional, short ids are used without it
+	HostMemoryBytes uint64         // Base of mem_pct for containers without a limit
+
+	names   map[string]string
+	tried   map[string]time.Time // Last lookup of the ids without a name
+	last    time.Time
+	lastCPU map[string]cgroupCounters
+}
+
+// cgroupCounters are the cumulative values turned into rates
+type cgroupCounters struct {
+	cpuUsageUsec     uint64
+	cpuThrottledUsec uint64
+	ioReadBytes      uint64
+	ioWriteBytes     uint64
+}
+
+func NewContainerCollector(cgroupRoot string, namer ContainerNamer) *ContainerCollector {
+	c := &ContainerCollector{CgroupRoot: cgroupRoot, Namer: namer}
+	if v, err := mem.VirtualMemory(); err == nil {
+		c.HostMemoryBytes = v.Total
+	}
+	return c
+}
+
+func (c *ContainerCollector) Collect(ctx context.Context) ([]db.ContainerMetric, error) {
+	now := time.Now()
+	elapsed := 0.0
+	if !c.last.IsZero() {
+		elapsed = now.Sub(c.last).Seconds()
+	}
+
+	// 1. Find the container cgroups
+	dirs, err := findContainerCgroups(c.CgroupRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Refresh the names only when a new container showed up
+	if c.needsNames(dirs, now) {
+		c.refreshNames(ctx, dirs, now)
+	}
+
+	// 3. Read every cgroup, containers may stop while we read them
+	var metrics []db.ContainerMetric
+	counters := make(map[string]cgroupCounters, len(dirs))
+	for id, dir := range dirs {
+		m, cur, err := readContainerCgroup(dir)
+		if err != nil {
+			continue
+		}
+		counters[id] = cur
+
+		m.RecordedAt = now
+		m.ContainerID = id
+		m.ContainerName = c.name(id)
+		if prev, ok := c.lastCPU[id]; ok && elapsed > 0 {
+			m.CpuPercent = rate(cur.cpuUsageUsec, prev.cpuUsageUsec, elapsed) / 1e6 * 100
+			m.CpuThrottledPercent = min(rate(cur.cpuThrottledUsec, prev.cpuThrottledUsec, elapsed)/1e6*100, 100)
+			m.IOReadBytesPerSec = rate(cur.ioReadBytes, prev.ioReadBytes, elapsed)
+			m.IOWriteBytesPerSec = rate(cur.ioWriteBytes, prev.ioWriteBytes, elapsed)
+		}
+		switch {
+		case m.MemLimitBytes > 0:
+			m.MemPercent = float64(m.MemBytes) / float64(m.MemLimitBytes) * 100
+		case c.HostMemoryBytes > 0:
+			m.MemPercent = float64(m.MemBytes) / float64(c.HostMemoryBytes) * 100
+		}
+		metrics = append(metrics, m)
+	}
+
+	c.lastCPU = counters
+	c.last = now
+	return metrics, nil
+}
+
+// needsNames reports whether a container has no name and wasn't looked up recently
+func (c *ContainerCollector) needsNames(dirs map[string]string, now time.Time) bool {
+	if c.Namer == nil {
+		return false
+	}
+	for id := range dirs {
+		if _, ok := c.names[id]; ok {
+			continue
+		}
+		if tried, ok := c.tried[id]; !ok || now.Sub(tried) >= nameRetryInterval {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ContainerCollector) refreshNames(ctx context.Context, dirs map[string]string, now time.Time) {
+	// Keep the old names on error, unknown ids fall back to their short form
+	if names, err := c.Namer.ContainerNames(ctx); err == nil {
+		c.names = names
+	}
+
+	// Remember the ids still without a name, ids that went away are forgotten
+	tried := make(map[string]time.Time)
+	for id := range dirs {
+		if _, ok := c.names[id]; !ok {
+			tried[id] = now
+		}
+	}
+	c.tried = tried
+}
+
+func (c *ContainerCollector) name(id string) string {
+	if name, ok := c.names[id]; ok && name != "" {
+		return name
+	}
+	return id[:12]
+}
+
+// findContainerCgroups returns the cgroup directory of every container by id
+func findContainerCgroups(root string) (map[string]string, error) {
+	dirs := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if match := containerCgroupPattern.FindStringSubmatch(d.Name()); match != nil {
+			dirs[match[1]] = path
+			return fs.SkipDir
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel != "." && strings.Count(rel, string(filepath.Separator))+1 >= maxCgroupDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading cgroup root %s: %w", root, err)
+	}
+	return dirs, nil
+}
+
+// readContainerCgroup reads cpu.stat, memory.current, memory.max, io.stat, pids.current and pids.max
+func readContainerCgroup(dir string) (db.ContainerMetric, cgroupCounters, error) {
+	var m db.ContainerMetric
+	var counters cgroupCounters
+
+	cpuStat, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return m, counters, err
+	}
+	counters.cpuUsageUsec = cpuStat["usage_usec"]
+	counters.cpuThrottledUsec = cpuStat["throttled_usec"]
+
+	if m.MemBytes, err = readCgroupValue(filepath.Join(dir, "memory.current")); err != nil {
+		return m, counters, err
+	}
+	// Controllers may be disabled for the subtree, missing files read as unlimited
+	m.MemLimitBytes, _ = readCgroupValue(filepath.Join(dir, "memory.max"))
+	pids, _ := readCgroupValue(filepath.Join(dir, "pids.current"))
+	pidsLimit, _ := readCgroupValue(filepath.Join(dir, "pids.max"))
+	m.Pids, m.PidsLimit = int(pids), int(pidsLimit)
+
+	counters.ioReadBytes, counters.ioWriteBytes, _ = readIOStat(filepath.Join(dir, "io.stat"))
+
+	return m, counters, nil
+}
+
+// readKeyValues parses flat keyed files such as cpu.stat: "usage_usec 1234"
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+// readCgroupValue parses single value files, "max" means unlimited and reads as 0
+func readCgroupValue(path string) (uint64, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(raw))
+	if s == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// readIOStat sums rbytes and wbytes over the devices: "8:0 rbytes=1 wbytes=2 rios=3 ..."
+func readIOStat(path string) (uint64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var read, write uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				read += v
+			case "wbytes":
+				write += v
+			}
+		}
+	}
+	return read, write, scanner.Err()
+}
+
+// DockerNamer asks the Docker Engine API on a unix socket for the container names
+type DockerNamer struct {
+	client *http.Client
+}
+
+func NewDockerNamer(socketPath string) *DockerNamer {
+	return &DockerNamer{
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+func (d *DockerNamer) ContainerNames(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker API returned %d", resp.StatusCode)
+	}
+
+	var containers []struct {
+		Id    string   `json:"Id"`
+		Names []string `json:"Names"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(containers))
+	for _, c := range containers {
+		if len(c.Names) > 0 {
+			names[c.Id] = strings.TrimPrefix(c.Names[0], "/")
+		}
+	}
+	return names, nil
+}
+
+// RunContainerMonitor stores a sample of every container on every tick until ctx is cancelled or ticks is closed
+func RunContainerMonitor(
+	ctx context.Context,
+	ticks <-chan time.Time,
+	collector *ContainerCollector,
+	store db.ContainerStore,
+	host db.Host,
+	log *slog.Logger,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ticks:
+			if !ok {
+				return
+			}
+		}
+
+		metrics, err := collector.Collect(ctx)
+		if err != nil {
+			hostSampleErrorsTotal.Inc()
+			log.Info(fmt.Sprintf("Error reading container metrics: %v", err))
+			continue
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		if err := store.InsertContainerMetrics(host, metrics); err != nil {
+			hostInsertErrorsTotal.Inc()
+			log.Info(fmt.Sprintf("Error inserting container metrics to DB: %v", err))
+		}
+	}
+}
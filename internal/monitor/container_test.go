@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	systemdID  = strings.Repeat("a", 64)
+	cgroupfsID = strings.Repeat("b", 64)
+)
+
+// writeCgroup creates a cgroup directory below root with the given files
+func writeCgroup(t *testing.T, root string, dir string, files map[string]string) {
+	t.Helper()
+	path := filepath.Join(root, dir)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func cgroupFiles(usageUsec string, rbytes string) map[string]string {
+	return map[string]string{
+		"cpu.stat":       "usage_usec " + usageUsec + "\nuser_usec 1\nthrottled_usec 0\n",
+		"memory.current": "268435456\n",
+		"memory.max":     "536870912\n",
+		"pids.current":   "7\n",
+		"pids.max":       "max\n",
+		"io.stat":        "8:0 rbytes=" + rbytes + " wbytes=100 rios=3 wios=1\n259:0 rbytes=0 wbytes=50\n",
+	}
+}
+
+// cgroupTree lays out a host with the systemd and the cgroupfs Docker driver
+func cgroupTree(t *testing.T) string {
+	root := t.TempDir()
+	writeCgroup(t, root, "system.slice/docker-"+systemdID+".scope", cgroupFiles("1000000", "4096"))
+	writeCgroup(t, root, "docker/"+cgroupfsID, map[string]string{
+		"cpu.stat":       "usage_usec 5\n",
+		"memory.current": "1024\n",
+	})
+	// Not containers: a service, a short id and a container nested too deep
+	writeCgroup(t, root, "system.slice/ssh.service", map[string]string{"cpu.stat": "usage_usec 1\n"})
+	writeCgroup(t, root, "docker/abc123", nil)
+	writeCgroup(t, root, "a/b/c/d/"+strings.Repeat("c", 64), nil)
+	return root
+}
+
+func TestFindContainerCgroups(t *testing.T) {
+	root := cgroupTree(t)
+	dirs, err := findContainerCgroups(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		systemdID:  filepath.Join(root, "system.slice", "docker-"+systemdID+".scope"),
+		cgroupfsID: filepath.Join(root, "docker", cgroupfsID),
+	}
+	if len(dirs) != len(want) {
+		t.Fatalf("got %v, want %v", dirs, want)
+	}
+	for id, dir := range want {
+		if dirs[id] != dir {
+			t.Errorf("%s: got %q, want %q", id[:12], dirs[id], dir)
+		}
+	}
+
+	if _, err := findContainerCgroups(filepath.Join(root, "missing")); err == nil {
+		t.Error("no error for a missing cgroup root")
+	}
+}
+
+func TestReadContainerCgroup(t *testing.T) {
+	root := cgroupTree(t)
+
+	m, counters, err := readContainerCgroup(filepath.Join(root, "system.slice", "docker-"+systemdID+".scope"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MemBytes != 256<<20 || m.MemLimitBytes != 512<<20 || m.Pids != 7 || m.PidsLimit != 0 {
+		t.Errorf("got %+v", m)
+	}
+	if counters.cpuUsageUsec != 1000000 || counters.ioReadBytes != 4096 || counters.ioWriteBytes != 150 {
+		t.Errorf("got counters %+v", counters)
+	}
+
+	// Disabled controllers leave out the limits, pids and io
+	m, counters, err = readContainerCgroup(filepath.Join(root, "docker", cgroupfsID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MemBytes != 1024 || m.MemLimitBytes != 0 || m.Pids != 0 || counters.ioReadBytes != 0 {
+		t.Errorf("got %+v, counters %+v", m, counters)
+	}
+
+	// A container that stopped has no files left
+	if _, _, err := readContainerCgroup(filepath.Join(root, "docker", "abc123")); err == nil {
+		t.Error("no error for an empty cgroup")
+	}
+}
+
+// countingNamer knows a fixed set of names and counts the lookups
+type countingNamer struct {
+	names map[string]string
+	calls int
+}
+
+func (n *countingNamer) ContainerNames(ctx context.Context) (map[string]string, error) {
+	n.calls++
+	return n.names, nil
+}
+
+func TestContainerCollector(t *testing.T) {
+	root := cgroupTree(t)
+	namer := &countingNamer{names: map[string]string{systemdID: "bot"}}
+	c := &ContainerCollector{CgroupRoot: root, Namer: namer, HostMemoryBytes: 4096}
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("got %d containers, want 2", len(metrics))
+	}
+	byID := func(id string) int {
+		for i, m := range metrics {
+			if m.ContainerID == id {
+				return i
+			}
+		}
+		t.Fatalf("container %s missing", id[:12])
+		return -1
+	}
+	if m := metrics[byID(systemdID)]; m.ContainerName != "bot" || m.MemPercent != 50 || m.CpuPercent != 0 {
+		t.Errorf("first sample %+v", m)
+	}
+	// No limit: memory is a share of the host, the id stands in for the unknown name
+	if m := metrics[byID(cgroupfsID)]; m.ContainerName != cgroupfsID[:12] || m.MemPercent != 25 {
+		t.Errorf("first sample %+v", m)
+	}
+
+	// One CPU second and 1 MB read over 10 seconds
+	c.last = c.last.Add(-10 * time.Second)
+	writeCgroup(t, root, "system.slice/docker-"+systemdID+".scope", cgroupFiles("2000000", "1052672"))
+	metrics, err = c.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics[byID(systemdID)]
+	if math.Abs(m.CpuPercent-10) > 0.1 || math.Abs(m.IOReadBytesPerSec-1<<20/10) > 1<<20/1000 {
+		t.Errorf("rates over 10s: cpu %.2f%%, read %.0f B/s", m.CpuPercent, m.IOReadBytesPerSec)
+	}
+
+	// The unnamed container is not looked up again on every tick
+	if namer.calls != 1 {
+		t.Errorf("namer called %d times, want once", namer.calls)
+	}
+	c.tried[cgroupfsID] = time.Now().Add(-nameRetryInterval)
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if namer.calls != 2 {
+		t.Errorf("namer called %d times, want a retry after %s", namer.calls, nameRetryInterval)
+	}
+}
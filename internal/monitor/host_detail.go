@@ -0,0 +1,285 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"vector-quant-monitor/internal/db"
+)
+
+// HostDetailCollector gathers the detailed host sample. Counters (network,
+// disk IO, process CPU time) are turned into rates against the previous call,
+// so the first sample only carries the gauges.
+//
+// Inside a container HOST_PROC should point at the host's /proc and DiskRoot
+// at the host's / (HOST_DISK_PATH), mountpoints are resolved below it.
+type HostDetailCollector struct {
+	DiskRoot     string
+	TopProcesses int // Top N by CPU plus top N by RSS
+
+	last     time.Time
+	lastNet  map[string]net.IOCountersStat
+	lastDisk map[string]disk.IOCountersStat
+	lastProc map[int32]float64 // CPU seconds by pid
+}
+
+func NewHostDetailCollector(diskRoot string, topProcesses int) *HostDetailCollector {
+	return &HostDetailCollector{
+		DiskRoot:     diskRoot,
+		TopProcesses: topProcesses,
+	}
+}
+
+func (h *HostDetailCollector) Collect(ctx context.Context) (db.HostDetail, error) {
+	now := time.Now()
+	elapsed := 0.0
+	if !h.last.IsZero() {
+		elapsed = now.Sub(h.last).Seconds()
+	}
+	detail := db.HostDetail{RecordedAt: now}
+
+	// 1. LOAD AND SWAP
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return detail, fmt.Errorf("reading load average: %w", err)
+	}
+	detail.Load1, detail.Load5, detail.Load15 = avg.Load1, avg.Load5, avg.Load15
+
+	swap, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return detail, fmt.Errorf("reading swap: %w", err)
+	}
+	detail.SwapTotalBytes, detail.SwapUsedBytes, detail.SwapPercent = swap.Total, swap.Used, swap.UsedPercent
+
+	// 2. PER-CORE CPU, percent since the previous call
+	cores, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return detail, fmt.Errorf("reading per-core CPU: %w", err)
+	}
+	for i, pct := range cores {
+		detail.Cores = append(detail.Cores, db.CPUCoreSample{Core: i, CpuPercent: pct})
+	}
+
+	// 3. NETWORK of the host namespace, /proc/net follows the reading process
+	interfaces, err := net.IOCountersByFileWithContext(ctx, true, hostProc("1", "net", "dev"))
+	if err != nil {
+		return detail, fmt.Errorf("reading network counters: %w", err)
+	}
+	netByName := make(map[string]net.IOCountersStat, len(interfaces))
+	for _, n := range interfaces {
+		netByName[n.Name] = n
+		prev, ok := h.lastNet[n.Name]
+		if n.Name == "lo" || !ok || elapsed == 0 {
+			continue
+		}
+		detail.Interfaces = append(detail.Interfaces, db.NetworkSample{
+			Interface:       n.Name,
+			RxBytesPerSec:   rate(n.BytesRecv, prev.BytesRecv, elapsed),
+			TxBytesPerSec:   rate(n.BytesSent, prev.BytesSent, elapsed),
+			RxPacketsPerSec: rate(n.PacketsRecv, prev.PacketsRecv, elapsed),
+			TxPacketsPerSec: rate(n.PacketsSent, prev.PacketsSent, elapsed),
+			RxErrors:        delta(n.Errin, prev.Errin),
+			TxErrors:        delta(n.Errout, prev.Errout),
+			RxDropped:       delta(n.Dropin, prev.Dropin),
+			TxDropped:       delta(n.Dropout, prev.Dropout),
+		})
+	}
+	h.lastNet = netByName
+
+	// 4. DISK IO, loop and ram devices are noise
+	disks, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return detail, fmt.Errorf("reading disk IO: %w", err)
+	}
+	for name, d := range disks {
+		prev, ok := h.lastDisk[name]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || !ok || elapsed == 0 {
+			continue
+		}
+		detail.Disks = append(detail.Disks, db.DiskIOSample{
+			Device:           name,
+			ReadBytesPerSec:  rate(d.ReadBytes, prev.ReadBytes, elapsed),
+			WriteBytesPerSec: rate(d.WriteBytes, prev.WriteBytes, elapsed),
+			ReadOpsPerSec:    rate(d.ReadCount, prev.ReadCount, elapsed),
+			WriteOpsPerSec:   rate(d.WriteCount, prev.WriteCount, elapsed),
+			BusyPercent:      min(rate(d.IoTime, prev.IoTime, elapsed)/10, 100), // IoTime is in ms
+		})
+	}
+	sort.Slice(detail.Disks, func(i, j int) bool { return detail.Disks[i].Device < detail.Disks[j].Device })
+	h.lastDisk = disks
+
+	// 5. FILESYSTEMS, usage and inodes of every physical mount
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return detail, fmt.Errorf("reading mounts: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, p := range partitions {
+		if seen[p.Mountpoint] {
+			continue
+		}
+		seen[p.Mountpoint] = true
+
+		usage, err := disk.UsageWithContext(ctx, filepath.Join(h.DiskRoot, p.Mountpoint))
+		if err != nil {
+			// Mounts the container can't see, e.g. not below HOST_DISK_PATH
+			continue
+		}
+		detail.Filesystems = append(detail.Filesystems, db.FilesystemSample{
+			Mountpoint:    p.Mountpoint,
+			Device:        p.Device,
+			Fstype:        p.Fstype,
+			TotalBytes:    usage.Total,
+			UsedBytes:     usage.Used,
+			UsedPercent:   usage.UsedPercent,
+			InodesTotal:   usage.InodesTotal,
+			InodesUsed:    usage.InodesUsed,
+			InodesPercent: usage.InodesUsedPercent,
+		})
+	}
+
+	// 6. PROCESSES
+	vm, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return detail, fmt.Errorf("reading memory: %w", err)
+	}
+	procs, cpuSeconds, err := h.processes(ctx, elapsed, vm.Total)
+	if err != nil {
+		return detail, err
+	}
+	detail.ProcessCount = len(cpuSeconds)
+	detail.Processes = topProcesses(procs, h.TopProcesses)
+	h.lastProc = cpuSeconds
+
+	h.last = now
+	return detail, nil
+}
+
+func (h *HostDetailCollector) processes(ctx context.Context, elapsed float64, memTotal uint64) ([]db.ProcessSample, map[int32]float64, error) {
+	list, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing processes: %w", err)
+	}
+
+	cpuSeconds := make(map[int32]float64, len(list))
+	var samples []db.ProcessSample
+	for _, p := range list {
+		// Processes may exit while we walk the list
+		times, err := p.TimesWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		memInfo, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		name, _ := p.NameWithContext(ctx)
+
+		used := times.User + times.System
+		cpuSeconds[p.Pid] = used
+
+		sample := db.ProcessSample{Pid: p.Pid, Name: name, RssBytes: memInfo.RSS}
+		if prev, ok := h.lastProc[p.Pid]; ok && elapsed > 0 && used >= prev {
+			sample.CpuPercent = (used - prev) / elapsed * 100
+		}
+		if memTotal > 0 {
+			sample.MemPercent = float64(memInfo.RSS) / float64(memTotal) * 100
+		}
+		samples = append(samples, sample)
+	}
+	return samples, cpuSeconds, nil
+}
+
+// topProcesses keeps the n heaviest processes by CPU and the n heaviest by RSS
+func topProcesses(procs []db.ProcessSample, n int) []db.ProcessSample {
+	if n <= 0 {
+		return nil
+	}
+	keep := make(map[int32]bool)
+
+	sort.Slice(procs, func(i, j int) bool { return procs[i].RssBytes > procs[j].RssBytes })
+	for _, p := range procs[:min(n, len(procs))] {
+		keep[p.Pid] = true
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].CpuPercent > procs[j].CpuPercent })
+	for _, p := range procs[:min(n, len(procs))] {
+		keep[p.Pid] = true
+	}
+
+	var top []db.ProcessSample
+	for _, p := range procs {
+		if keep[p.Pid] {
+			top = append(top, p)
+		}
+	}
+	return top
+}
+
+// RunHostDetailMonitor stores a detailed sample on every tick until ctx is cancelled or ticks is closed
+func RunHostDetailMonitor(
+	ctx context.Context,
+	ticks <-chan time.Time,
+	collector *HostDetailCollector,
+	store db.HostDetailStore,
+	host db.Host,
+	log *slog.Logger,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ticks:
+			if !ok {
+				return
+			}
+		}
+
+		detail, err := collector.Collect(ctx)
+		if err != nil {
+			hostSampleErrorsTotal.Inc()
+			log.Info(fmt.Sprintf("Error reading host details: %v", err))
+			continue
+		}
+		if err := store.InsertHostDetail(host, detail); err != nil {
+			hostInsertErrorsTotal.Inc()
+			log.Info(fmt.Sprintf("Error inserting host details to DB: %v", err))
+		}
+	}
+}
+
+// hostProc joins parts below HOST_PROC, the same root gopsutil reads from
+func hostProc(parts ...string) string {
+	root := os.Getenv("HOST_PROC")
+	if root == "" {
+		root = "/proc"
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// rate is the per second increase, a counter that went backwards was reset
+func rate(current uint64, previous uint64, seconds float64) float64 {
+	if current < previous || seconds <= 0 {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
+
+func delta(current uint64, previous uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
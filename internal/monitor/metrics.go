@@ -0,0 +1,44 @@
+package monitor
+
+import "vector-quant-monitor/internal/metrics"
+
+var (
+	hostCPUPercent = metrics.NewGauge(
+		"vqm_host_cpu_percent",
+		"Host CPU usage of the last sample.",
+	)
+	hostMemPercent = metrics.NewGauge(
+		"vqm_host_mem_percent",
+		"Host memory usage of the last sample.",
+	)
+	hostDiskPercent = metrics.NewGauge(
+		"vqm_host_disk_percent",
+		"Host disk usage of the last sample.",
+	)
+	hostSampleErrorsTotal = metrics.NewCounter(
+		"vqm_host_sample_errors_total",
+		"Host samples that could not be read.",
+	)
+	hostInsertErrorsTotal = metrics.NewCounter(
+		"vqm_host_insert_errors_total",
+		"Host samples that could not be stored.",
+	)
+	userStreamEventsTotal = metrics.NewCounter(
+		"vqm_userstream_events_total",
+		"User-data events received, by event type.",
+		"type",
+	)
+	userStreamPersistErrorsTotal = metrics.NewCounter(
+		"vqm_userstream_persist_errors_total",
+		"User-data events that could not be stored, by event type.",
+		"type",
+	)
+	userStreamReconnectsTotal = metrics.NewCounter(
+		"vqm_userstream_reconnects_total",
+		"User stream reconnects after a disconnect or failed connect.",
+	)
+	userStreamConnected = metrics.NewGauge(
+		"vqm_userstream_connected",
+		"1 while the user stream WebSocket is connected.",
+	)
+)
@@ -1,42 +1,34 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 
+	"vector-quant-monitor/internal/alert"
 	"vector-quant-monitor/internal/config"
 	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/health"
+	"vector-quant-monitor/internal/identity"
+	"vector-quant-monitor/internal/notifier"
 )
 
-func StartMonitorHost(interval time.Duration, log *slog.Logger) error {
-	config := config.LoadConfig()
-	log.Info(
-		fmt.Sprintf("Connecting to PostgresqldDB to %s",
-			config.Database.DBName,
-		),
-	)
-	dbConnectionString := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		config.Database.DBUser,
-		config.Database.DBPassword,
-		config.Database.DBHost,
-		fmt.Sprintf("%d", config.Database.DBPort),
-		config.Database.DBName,
-	)
-	db := db.NewPostgreSQLDB(
-		dbConnectionString,
-		log,
-	)
-	if db == nil {
-		log.Info("Failed to connect to DB")
+func StartMonitorHost(ctx context.Context, config *config.AppConfig, interval time.Duration, log *slog.Logger) error {
+	store, err := db.Connect(config.Database, log)
+	if err != nil {
+		return err
 	}
-	defer db.DB.Close()
+	defer store.DB.Close()
+	// Every component pings its own connection, which closes when it stops
+	defer health.RegisterCheck("host-db", true, store.DB.PingContext).Unregister()
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -49,38 +41,136 @@ func StartMonitorHost(interval time.Duration, log *slog.Logger) error {
 
 	log.Info(fmt.Sprintf("Monitoring Host Disk at: %s", hostDiskPath))
 
-	for range ticker.C {
-		// 1. HOST MEMORY
-		// gopsutil automatically uses HOST_PROC env var to read /host/proc/meminfo
-		v, err := mem.VirtualMemory()
-		if err != nil {
-			log.Info(fmt.Sprintf("Error reading memory: %v", err))
-			continue
-		}
+	// Every row carries the host name and labels, several hosts can share the database
+	id := identity.Discover(ctx, config.Host, log)
+	err = store.UpsertHostIdentity(db.HostIdentity{
+		Resource:         id.Name,
+		Hostname:         id.Hostname,
+		InstanceID:       id.InstanceID,
+		InstanceType:     id.InstanceType,
+		AvailabilityZone: id.AvailabilityZone,
+		Region:           id.Region,
+		Labels:           id.Labels,
+	})
+	if err != nil {
+		log.Info(fmt.Sprintf("Error recording host identity: %v", err))
+	}
+	host := db.Host{Resource: id.Name, Labels: id.Labels}
 
-		// 2. HOST CPU
-		// gopsutil automatically uses HOST_PROC env var to read /host/proc/stat
-		c, err := cpu.Percent(0, false)
-		if err != nil {
-			log.Info(fmt.Sprintf("Error reading CPU: %v", err))
-			continue
+	// Writes are batched and spooled to disk while Postgres is unreachable. The
+	// writers outlive the monitors so the last samples are flushed or spooled.
+	buffered := newBufferedStore(store, config.Worker, log)
+	writerCtx, stopWriters := context.WithCancel(context.Background())
+	writersDone := buffered.run(writerCtx)
+	defer func() {
+		stopWriters()
+		<-writersDone
+	}()
+
+	rules, err := alert.LoadRules(config.Alert.RulesFile)
+	if err != nil {
+		log.Info(fmt.Sprintf("Error loading alert rules, using defaults: %v", err))
+		rules = alert.DefaultRules()
+	}
+	engine := alert.NewEngine(rules)
+	notify := notifier.New(
+		config.Notifier.DiscordWebhookURL,
+		config.Notifier.DiscordUsername,
+		log,
+	)
+	source := &HostMetricSource{DiskPath: hostDiskPath}
+
+	// Readiness fails after three missed samples
+	status := health.Register("host", true, 3*interval)
+
+	// Details and containers go to their own tables on their own tickers,
+	// a slow process or cgroup walk doesn't delay alerts
+	var wg sync.WaitGroup
+	detailTicker := time.NewTicker(interval)
+	defer detailTicker.Stop()
+	collector := NewHostDetailCollector(hostDiskPath, config.Worker.HostTopProcesses)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		RunHostDetailMonitor(ctx, detailTicker.C, collector, buffered, host, log)
+	}()
+
+	if config.Worker.CgroupRoot != "" {
+		log.Info(fmt.Sprintf("Monitoring containers below: %s", config.Worker.CgroupRoot))
+		containerTicker := time.NewTicker(interval)
+		defer containerTicker.Stop()
+		containers := NewContainerCollector(config.Worker.CgroupRoot, NewDockerNamer(config.Worker.DockerSocket))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RunContainerMonitor(ctx, containerTicker.C, containers, buffered, host, log)
+		}()
+	}
+
+	RunHostMonitor(ctx, ticker.C, source, buffered, host, engine, notify, status, log)
+	wg.Wait()
+	return nil
+}
+
+// RunHostMonitor takes a sample on every tick, evaluates the alert rules and
+// stores the sample, until ctx is cancelled or ticks is closed
+func RunHostMonitor(
+	ctx context.Context,
+	ticks <-chan time.Time,
+	source alert.MetricSource,
+	store db.MetricStore,
+	host db.Host,
+	engine *alert.Engine,
+	notify notifier.Notifier,
+	status *health.Component,
+	log *slog.Logger,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ticks:
+			if !ok {
+				return
+			}
 		}
 
-		// 3. HOST DISK
-		// We explicitly ask for usage of the mounted path
-		d, err := disk.Usage(hostDiskPath)
+		sample, err := source.Sample()
 		if err != nil {
-			log.Info(fmt.Sprintf("Error reading disk: %v", err))
+			hostSampleErrorsTotal.Inc()
+			status.Failure(err)
+			log.Info(fmt.Sprintf("Error reading host metrics: %v", err))
 			continue
 		}
 
 		// EXTRACT PERCENTAGES
-		cpuPercent := c[0]
-		ramPercent := v.UsedPercent
-		diskPercent := d.UsedPercent
+		cpuPercent := sample.Values[MetricCPUPercent]
+		ramPercent := sample.Values[MetricMemPercent]
+		diskPercent := sample.Values[MetricDiskPercent]
+		status.Success()
+		hostCPUPercent.Set(cpuPercent)
+		hostMemPercent.Set(ramPercent)
+		hostDiskPercent.Set(diskPercent)
+
+		// ALERTS are evaluated before the insert so a DB outage doesn't silence them
+		events := engine.Evaluate(sample)
+		for _, ev := range events {
+			log.Info(fmt.Sprintf("Alert %s %s (value %.2f)", ev.Rule.Name, ev.Status, ev.Value))
+		}
+		if err := alert.Route(ctx, notify, events); err != nil {
+			log.Info(fmt.Sprintf("Error sending alert notification: %v", err))
+		}
 
-		dbErr := db.InsertHostMetrics(db.DB, cpuPercent, ramPercent, diskPercent)
+		dbErr := store.InsertHostMetrics([]db.HostMetric{{
+			Host:        host,
+			RecordedAt:  sample.Time,
+			CpuPercent:  cpuPercent,
+			RamPercent:  ramPercent,
+			DiskPercent: diskPercent,
+		}})
 		if dbErr != nil {
+			hostInsertErrorsTotal.Inc()
+			status.Failure(dbErr)
 			log.Info(fmt.Sprintf("Error inserting metrics to DB: %v", dbErr))
 			continue
 		}
@@ -88,8 +178,66 @@ func StartMonitorHost(interval time.Duration, log *slog.Logger) error {
 		// LOGGING (For verification)
 		// If RAM matches your EC2 size (e.g. 2GB/4GB) instead of container limit, it works.
 		log.Info(fmt.Sprintf("HOST STATS -> CPU: %.1f%% | RAM: %.1f%% (Total: %.0fMB) | Disk: %.1f%%",
-			cpuPercent, ramPercent, float64(v.Total)/1024/1024, diskPercent))
+			cpuPercent, ramPercent, sample.Values[MetricMemTotalMB], diskPercent))
 	}
+}
 
-	return nil
+// Metric names usable in alert rules
+const (
+	MetricCPUPercent  = "cpu_pct"
+	MetricMemPercent  = "mem_pct"
+	MetricMemTotalMB  = "mem_total_mb"
+	MetricDiskPercent = "disk_pct"
+	MetricLoad1       = "load1"
+	MetricSwapPercent = "swap_pct"
+)
+
+// HostMetricSource reads host-wide usage through gopsutil
+type HostMetricSource struct {
+	DiskPath string
+}
+
+func (h *HostMetricSource) Sample() (alert.Sample, error) {
+	// 1. HOST MEMORY
+	// gopsutil automatically uses HOST_PROC env var to read /host/proc/meminfo
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		return alert.Sample{}, fmt.Errorf("reading memory: %w", err)
+	}
+
+	// 2. HOST CPU
+	// gopsutil automatically uses HOST_PROC env var to read /host/proc/stat
+	c, err := cpu.Percent(0, false)
+	if err != nil {
+		return alert.Sample{}, fmt.Errorf("reading CPU: %w", err)
+	}
+
+	// 3. HOST DISK
+	// We explicitly ask for usage of the mounted path
+	d, err := disk.Usage(h.DiskPath)
+	if err != nil {
+		return alert.Sample{}, fmt.Errorf("reading disk: %w", err)
+	}
+
+	// 4. LOAD AND SWAP, so rules can alert on them too
+	l, err := load.Avg()
+	if err != nil {
+		return alert.Sample{}, fmt.Errorf("reading load average: %w", err)
+	}
+	s, err := mem.SwapMemory()
+	if err != nil {
+		return alert.Sample{}, fmt.Errorf("reading swap: %w", err)
+	}
+
+	return alert.Sample{
+		Time: time.Now(),
+		Values: map[string]float64{
+			MetricCPUPercent:  c[0],
+			MetricMemPercent:  v.UsedPercent,
+			MetricMemTotalMB:  float64(v.Total) / 1024 / 1024,
+			MetricDiskPercent: d.UsedPercent,
+			MetricLoad1:       l.Load1,
+			MetricSwapPercent: s.UsedPercent,
+		},
+	}, nil
 }
@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/alert"
+	"vector-quant-monitor/internal/db"
+	"vector-quant-monitor/internal/health"
+	"vector-quant-monitor/internal/notifier"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// scriptedSource returns one sample or error per call
+type scriptedSource struct {
+	samples []alert.Sample
+	errs    []error
+}
+
+func (s *scriptedSource) Sample() (alert.Sample, error) {
+	sample, err := s.samples[0], s.errs[0]
+	s.samples, s.errs = s.samples[1:], s.errs[1:]
+	return sample, err
+}
+
+// recordingNotifier keeps every message it was asked to send
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notifier.Message
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, msg notifier.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func componentStatus(t *testing.T, name string) health.ComponentStatus {
+	t.Helper()
+	for _, c := range health.Check(context.Background()).Components {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("component %s not registered", name)
+	return health.ComponentStatus{}
+}
+
+func TestRunHostMonitor(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(minute int, cpu float64) alert.Sample {
+		return alert.Sample{
+			Time:   t0.Add(time.Duration(minute) * time.Minute),
+			Values: map[string]float64{MetricCPUPercent: cpu, MetricMemPercent: 40, MetricDiskPercent: 50},
+		}
+	}
+	source := &scriptedSource{
+		samples: []alert.Sample{sample(0, 10), {}, sample(2, 95), sample(3, 20)},
+		errs:    []error{nil, errors.New("proc unreadable"), nil, nil},
+	}
+	store := db.NewMemoryStore()
+	notify := &recordingNotifier{}
+	engine := alert.NewEngine([]alert.Rule{{Name: "cpu", Metric: MetricCPUPercent, Operator: alert.OperatorAbove, Threshold: 90}})
+	status := health.Register("host-monitor-test", true, time.Hour)
+	host := db.Host{Resource: "bot-1", Labels: map[string]string{"role": "bot"}}
+
+	// run processes n ticks and returns once they are done
+	run := func(n int) {
+		ticks := make(chan time.Time, n)
+		for range n {
+			ticks <- time.Now()
+		}
+		close(ticks)
+		RunHostMonitor(context.Background(), ticks, source, store, host, engine, notify, status, discard)
+	}
+
+	run(2)
+	if c := componentStatus(t, "host-monitor-test"); c.LastError != "proc unreadable" {
+		t.Errorf("after a failed sample last error %q", c.LastError)
+	}
+
+	// The database goes away while the CPU alert fires, the alert still goes out
+	store.Err = errors.New("connection refused")
+	run(1)
+	if c := componentStatus(t, "host-monitor-test"); c.LastError != "connection refused" {
+		t.Errorf("after a failed insert last error %q", c.LastError)
+	}
+	store.Err = nil
+	run(1)
+
+	if len(store.HostMetrics) != 2 {
+		t.Fatalf("stored %d samples, want the 2 that were sampled and written", len(store.HostMetrics))
+	}
+	for i, want := range []alert.Sample{sample(0, 10), sample(3, 20)} {
+		got := store.HostMetrics[i]
+		if !got.RecordedAt.Equal(want.Time) || got.CpuPercent != want.Values[MetricCPUPercent] || got.Host.Resource != "bot-1" {
+			t.Errorf("sample %d: got %+v", i, got)
+		}
+	}
+
+	if len(notify.messages) != 2 {
+		t.Fatalf("sent %d notifications, want firing and resolved", len(notify.messages))
+	}
+	if notify.messages[1].Severity != notifier.SeverityResolved {
+		t.Errorf("second notification severity %s, want resolved", notify.messages[1].Severity)
+	}
+	if c := componentStatus(t, "host-monitor-test"); c.LastError != "" || c.LastSuccess == nil {
+		t.Errorf("after a stored sample got %+v", c)
+	}
+}
@@ -0,0 +1,221 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+
+	"vector-quant-monitor/util"
+)
+
+// Gap is a window in which the user stream was not connected, trades executed
+// inside it have to be repaired by the backfill.
+type Gap struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+// UserStream keeps a futures user-data WebSocket alive. It renews the listen key,
+// reconnects with exponential backoff and reports every outage: OnDisconnect
+// as soon as it starts, OnConnect and OnGap once the stream is back.
+type UserStream struct {
+	Client            *futures.Client
+	WsBaseURL         string
+	KeepaliveInterval time.Duration
+	ReadTimeout       time.Duration
+	MinBackoff        time.Duration
+	MaxBackoff        time.Duration
+
+	Handler      func(event *futures.WsUserDataEvent)
+	OnDisconnect func(from time.Time, reason string) // The account is no longer observed
+	OnConnect    func(at time.Time)                  // Every successful connect, the first one included
+	OnGap        func(gap Gap)                       // After OnConnect when it ended an outage
+	OnActivity   func()                              // Connects, events and pings, proves the stream is alive
+
+	log *slog.Logger
+}
+
+func NewUserStream(client *futures.Client, handler func(event *futures.WsUserDataEvent), log *slog.Logger) *UserStream {
+	return &UserStream{
+		Client:            client,
+		WsBaseURL:         futures.BaseWsMainUrl,
+		KeepaliveInterval: 50 * time.Minute,
+		ReadTimeout:       10 * time.Minute, // Binance pings every 3 minutes
+		MinBackoff:        time.Second,
+		MaxBackoff:        2 * time.Minute,
+		Handler:           handler,
+		OnDisconnect:      func(from time.Time, reason string) {},
+		OnConnect:         func(at time.Time) {},
+		OnGap:             func(gap Gap) {},
+		OnActivity:        func() {},
+		log:               log,
+	}
+}
+
+// Run blocks until ctx is cancelled
+func (s *UserStream) Run(ctx context.Context) error {
+	var disconnectedAt time.Time
+	var disconnectReason string
+	attempt := 0
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		conn, listenKey, err := s.connect(ctx)
+		if err != nil {
+			wait := util.Backoff(attempt, s.MinBackoff, s.MaxBackoff)
+			attempt++
+			s.log.Info(fmt.Sprintf("User stream connect failed (attempt %d), retrying in %s: %v", attempt, wait, err))
+			if disconnectedAt.IsZero() {
+				disconnectedAt = time.Now()
+				disconnectReason = err.Error()
+				s.OnDisconnect(disconnectedAt, disconnectReason)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+			continue
+		}
+		attempt = 0
+
+		// Close the outage once we are observing the account again
+		connectedAt := time.Now()
+		s.OnConnect(connectedAt)
+		if !disconnectedAt.IsZero() {
+			userStreamReconnectsTotal.Inc()
+			gap := Gap{From: disconnectedAt, To: connectedAt, Reason: disconnectReason}
+			s.log.Info(fmt.Sprintf("User stream reconnected, gap %s -> %s (%s)",
+				gap.From.Format(time.RFC3339), gap.To.Format(time.RFC3339), gap.Reason))
+			s.OnGap(gap)
+			disconnectedAt = time.Time{}
+		}
+
+		userStreamConnected.Set(1)
+		s.OnActivity()
+		err = s.serve(ctx, conn, listenKey)
+		userStreamConnected.Set(0)
+		if ctx.Err() != nil {
+			return nil
+		}
+		disconnectedAt = time.Now()
+		disconnectReason = err.Error()
+		s.log.Info(fmt.Sprintf("User stream disconnected: %v", err))
+		s.OnDisconnect(disconnectedAt, disconnectReason)
+	}
+}
+
+func (s *UserStream) connect(ctx context.Context) (*websocket.Conn, string, error) {
+	// A fresh listen key every time, the old one may be the reason we dropped
+	listenKey, err := s.Client.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("listen key: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s", strings.TrimSuffix(s.WsBaseURL, "/"), listenKey)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("dial: %w", err)
+	}
+	return conn, listenKey, nil
+}
+
+// serve reads events until the connection drops, the listen key expires or
+// the keepalive fails, and returns the reason.
+func (s *UserStream) serve(ctx context.Context, conn *websocket.Conn, listenKey string) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	keepaliveErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(s.KeepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// Unblocks ReadMessage, the close handshake is done by shutdown
+				conn.SetReadDeadline(time.Now())
+				return
+			case <-ticker.C:
+				err := s.Client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx)
+				if err != nil {
+					// Closing the socket unblocks ReadMessage and triggers a reconnect
+					keepaliveErr <- fmt.Errorf("keepalive failed: %w", err)
+					conn.Close()
+					return
+				}
+				s.log.Info("--- 🔄 ListenKey Refreshed ---")
+			}
+		}
+	}()
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	conn.SetPingHandler(func(data string) error {
+		s.OnActivity()
+		conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if ctx.Err() != nil {
+			s.shutdown(conn, listenKey)
+			return ctx.Err()
+		}
+		if err != nil {
+			select {
+			case kaErr := <-keepaliveErr:
+				return kaErr
+			default:
+				return err
+			}
+		}
+		conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		s.OnActivity()
+
+		event := new(futures.WsUserDataEvent)
+		if err := json.Unmarshal(message, event); err != nil {
+			s.log.Info(fmt.Sprintf("Could not decode user-data event: %v", err))
+			continue
+		}
+
+		if event.Event == futures.UserDataEventTypeListenKeyExpired {
+			return fmt.Errorf("listenKey expired")
+		}
+		s.Handler(event)
+	}
+}
+
+// shutdown says goodbye to Binance: a close frame on the socket and deleting
+// the listen key so it doesn't linger for 60 minutes
+func (s *UserStream) shutdown(conn *websocket.Conn, listenKey string) {
+	deadline := time.Now().Add(5 * time.Second)
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutdown"),
+		deadline,
+	)
+	conn.Close()
+
+	// ctx is already cancelled, the delete gets its own short deadline
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := s.Client.NewCloseUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+		s.log.Info(fmt.Sprintf("Could not delete ListenKey: %v", err))
+		return
+	}
+	s.log.Info("User stream closed and ListenKey deleted")
+}
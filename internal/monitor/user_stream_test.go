@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+)
+
+// binanceStub stands in for the listen key REST endpoints and the user-data
+// WebSocket. Every connection plays the next script, the last one is kept open.
+type binanceStub struct {
+	t       *testing.T
+	scripts []func(conn *websocket.Conn)
+
+	mu          sync.Mutex
+	keyRequests int
+	failKeys    int // Listen key requests answered with 500 first
+	deletedKeys []string
+	conns       int
+}
+
+func (b *binanceStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/fapi/v1/listenKey" && r.Method == http.MethodPost:
+		b.keyRequests++
+		if b.keyRequests <= b.failKeys {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"code": -1001, "msg": "Internal error"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"listenKey": "key-%d"}`, b.keyRequests-b.failKeys)
+	case r.URL.Path == "/fapi/v1/listenKey" && r.Method == http.MethodPut:
+		io.WriteString(w, `{}`)
+	case r.URL.Path == "/fapi/v1/listenKey" && r.Method == http.MethodDelete:
+		// ParseForm ignores DELETE bodies
+		raw, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(raw))
+		key := form.Get("listenKey")
+		if key == "" {
+			key = r.URL.Query().Get("listenKey")
+		}
+		b.deletedKeys = append(b.deletedKeys, key)
+		io.WriteString(w, `{}`)
+	case strings.HasPrefix(r.URL.Path, "/ws/"):
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			b.t.Errorf("upgrade: %v", err)
+			return
+		}
+		script := b.scripts[min(b.conns, len(b.scripts)-1)]
+		b.conns++
+		go script(conn)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func configUpdate(symbol string) string {
+	return fmt.Sprintf(`{"e": "ACCOUNT_CONFIG_UPDATE", "E": %d, "T": %d, "ac": {"s": %q, "l": 20}}`,
+		time.Now().UnixMilli(), time.Now().UnixMilli(), symbol)
+}
+
+func send(conn *websocket.Conn, messages ...string) {
+	for _, m := range messages {
+		conn.WriteMessage(websocket.TextMessage, []byte(m))
+	}
+}
+
+// waitClosed reads until the client goes away
+func waitClosed(conn *websocket.Conn) {
+	defer conn.Close()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func TestUserStreamReconnects(t *testing.T) {
+	stub := &binanceStub{t: t, failKeys: 1}
+	stub.scripts = []func(conn *websocket.Conn){
+		// Binance ends the listen key
+		func(conn *websocket.Conn) {
+			send(conn, configUpdate("BTCUSDT"), `{"e": "listenKeyExpired", "E": 1}`)
+			waitClosed(conn)
+		},
+		// The connection drops without a close frame
+		func(conn *websocket.Conn) {
+			send(conn, configUpdate("ETHUSDT"))
+			time.Sleep(20 * time.Millisecond)
+			conn.UnderlyingConn().Close()
+		},
+		// Healthy until the test shuts down
+		func(conn *websocket.Conn) {
+			send(conn, configUpdate("SOLUSDT"))
+			waitClosed(conn)
+		},
+	}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	client := futures.NewClient("api-key", "secret")
+	client.BaseURL = server.URL
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, fmt.Sprintf(format, args...))
+	}
+	events := make(chan string, 10)
+
+	stream := NewUserStream(client, func(event *futures.WsUserDataEvent) {
+		record("event %s", event.AccountConfigUpdate.Symbol)
+		events <- event.AccountConfigUpdate.Symbol
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	stream.WsBaseURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	stream.MinBackoff = 5 * time.Millisecond
+	stream.MaxBackoff = 20 * time.Millisecond
+
+	var gaps []Gap
+	stream.OnDisconnect = func(from time.Time, reason string) { record("disconnect %s", reason) }
+	stream.OnConnect = func(at time.Time) { record("connect") }
+	stream.OnGap = func(gap Gap) {
+		mu.Lock()
+		gaps = append(gaps, gap)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- stream.Run(ctx) }()
+
+	var received []string
+	timeout := time.After(5 * time.Second)
+	for len(received) < 3 {
+		select {
+		case symbol := <-events:
+			received = append(received, symbol)
+		case <-timeout:
+			t.Fatalf("received only %v", received)
+		}
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"disconnect listen key",
+		"connect",
+		"event BTCUSDT",
+		"disconnect listenKey expired",
+		"connect",
+		"event ETHUSDT",
+		"disconnect ",
+		"connect",
+		"event SOLUSDT",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got calls %q, want %q", calls, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(calls[i], want[i]) {
+			t.Errorf("call %d: got %q, want prefix %q", i, calls[i], want[i])
+		}
+	}
+
+	if len(gaps) != 3 {
+		t.Fatalf("got %d gaps, want 3", len(gaps))
+	}
+	for _, gap := range gaps {
+		if gap.To.Before(gap.From) || gap.Reason == "" {
+			t.Errorf("bad gap %+v", gap)
+		}
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	// One failed request, then a fresh key for every connection
+	if stub.keyRequests != 4 {
+		t.Errorf("got %d listen key requests, want 4", stub.keyRequests)
+	}
+	if len(stub.deletedKeys) != 1 || stub.deletedKeys[0] != "key-3" {
+		t.Errorf("deleted listen keys %v, want [key-3]", stub.deletedKeys)
+	}
+}
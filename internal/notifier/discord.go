@@ -1 +1,291 @@
 package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Discord embed limits, see https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const (
+	maxTitleLen       = 256
+	maxDescriptionLen = 4096
+	maxFields         = 25
+	maxFieldNameLen   = 256
+	maxFieldValueLen  = 1024
+	maxEmbedsPerMsg   = 10
+	maxCharsPerMsg    = 6000
+)
+
+const defaultMaxRetries = 3
+
+type DiscordNotifier struct {
+	WebhookURL string
+	Username   string
+	Client     *http.Client
+	MaxRetries int
+	log        *slog.Logger
+}
+
+type discordPayload struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Body Discord returns together with HTTP 429
+type discordRateLimit struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"` // seconds
+	Global     bool    `json:"global"`
+}
+
+func NewDiscordNotifier(webhookURL string, username string, log *slog.Logger) *DiscordNotifier {
+	return &DiscordNotifier{
+		WebhookURL: webhookURL,
+		Username:   username,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: defaultMaxRetries,
+		log:        log,
+	}
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, msg Message) error {
+	// 1. Split the message into embeds which respect the per embed limits
+	embeds := buildEmbeds(msg)
+
+	// 2. Group embeds into webhook calls which respect the per message limits
+	batches := batchEmbeds(embeds, 0)
+	if len(batches) > 1 {
+		// Every batch starts with the tagged title, pack again leaving room for it
+		batches = batchEmbeds(embeds, taggedTitleLen(msg.Title, len(embeds)))
+	}
+
+	for i, batch := range batches {
+		// Tag every batch with the title so split messages stay readable
+		if len(batches) > 1 {
+			batch[0].Title = truncate(
+				fmt.Sprintf("%s (%d/%d)", msg.Title, i+1, len(batches)),
+				maxTitleLen,
+			)
+		}
+
+		err := d.send(ctx, discordPayload{Username: d.Username, Embeds: batch})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DiscordNotifier) send(ctx context.Context, payload discordPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := d.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("discord webhook returned %d: %s", resp.StatusCode, string(respBody))
+		}
+
+		if attempt >= d.MaxRetries {
+			return fmt.Errorf("discord webhook still rate limited after %d retries", d.MaxRetries)
+		}
+
+		wait := retryAfter(resp.Header, respBody)
+		if d.log != nil {
+			d.log.Info(fmt.Sprintf("Discord rate limited, retrying in %s", wait))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryAfter prefers the JSON body because it carries sub-second precision
+func retryAfter(header http.Header, body []byte) time.Duration {
+	var limit discordRateLimit
+	if err := json.Unmarshal(body, &limit); err == nil && limit.RetryAfter > 0 {
+		return time.Duration(limit.RetryAfter * float64(time.Second))
+	}
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return time.Second
+}
+
+func buildEmbeds(msg Message) []discordEmbed {
+	timestamp := msg.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	newEmbed := func() discordEmbed {
+		return discordEmbed{
+			Color:     severityColor(msg.Severity),
+			Timestamp: timestamp.UTC().Format(time.RFC3339),
+		}
+	}
+
+	// Long descriptions continue in the following embeds
+	var embeds []discordEmbed
+	for i, chunk := range splitText(msg.Description, maxDescriptionLen) {
+		embed := newEmbed()
+		if i == 0 {
+			embed.Title = truncate(msg.Title, maxTitleLen)
+		}
+		embed.Description = chunk
+		embeds = append(embeds, embed)
+	}
+
+	for _, f := range msg.Fields {
+		field := discordField{
+			Name:   truncate(orBlank(f.Name), maxFieldNameLen),
+			Value:  truncate(orBlank(f.Value), maxFieldValueLen),
+			Inline: f.Inline,
+		}
+
+		last := &embeds[len(embeds)-1]
+		// Any embed may start a batch, keep room for a title of maximum length
+		if len(last.Fields) >= maxFields || last.bodySize()+field.size() > maxCharsPerMsg-maxTitleLen {
+			embeds = append(embeds, newEmbed())
+			last = &embeds[len(embeds)-1]
+		}
+		last.Fields = append(last.Fields, field)
+	}
+
+	return embeds
+}
+
+// batchEmbeds groups embeds into messages, counting the title of the first
+// embed of every message as at least titleLen characters
+func batchEmbeds(embeds []discordEmbed, titleLen int) [][]discordEmbed {
+	var batches [][]discordEmbed
+	var current []discordEmbed
+	currentSize := 0
+
+	for _, embed := range embeds {
+		if len(current) >= maxEmbedsPerMsg || (len(current) > 0 && currentSize+embed.size() > maxCharsPerMsg) {
+			batches = append(batches, current)
+			current = nil
+			currentSize = 0
+		}
+		size := embed.size()
+		if len(current) == 0 {
+			size = embed.bodySize() + max(utf8.RuneCountInString(embed.Title), titleLen)
+		}
+		current = append(current, embed)
+		currentSize += size
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// taggedTitleLen is the longest "title (i/n)" a message split into at most
+// n batches gets
+func taggedTitleLen(title string, n int) int {
+	return min(utf8.RuneCountInString(fmt.Sprintf("%s (%d/%d)", title, n, n)), maxTitleLen)
+}
+
+func (e discordEmbed) size() int {
+	return utf8.RuneCountInString(e.Title) + e.bodySize()
+}
+
+// bodySize counts everything but the title
+func (e discordEmbed) bodySize() int {
+	n := utf8.RuneCountInString(e.Description)
+	for _, f := range e.Fields {
+		n += f.size()
+	}
+	return n
+}
+
+func (f discordField) size() int {
+	return utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+}
+
+func severityColor(severity Severity) int {
+	switch severity {
+	case SeverityCritical:
+		return 0xE74C3C // red
+	case SeverityWarning:
+		return 0xF1C40F // yellow
+	case SeverityResolved:
+		return 0x2ECC71 // green
+	default:
+		return 0x3498DB // blue
+	}
+}
+
+// splitText cuts s into rune-safe chunks of at most limit characters
+func splitText(s string, limit int) []string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return []string{s}
+	}
+	var chunks []string
+	for len(runes) > 0 {
+		n := min(limit, len(runes))
+		chunks = append(chunks, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return chunks
+}
+
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// Discord rejects empty field names and values
+func orBlank(s string) string {
+	if s == "" {
+		return "\u200b"
+	}
+	return s
+}
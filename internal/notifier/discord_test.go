@@ -0,0 +1,258 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// webhookStub stands in for the Discord webhook, answering with the queued
+// statuses (204 once they run out) and recording every payload
+type webhookStub struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	payloads []discordPayload
+}
+
+func (s *webhookStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	var payload discordPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads = append(s.payloads, payload)
+	status, body := http.StatusNoContent, ""
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	if len(s.bodies) > 0 {
+		body, s.bodies = s.bodies[0], s.bodies[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
+
+func newTestNotifier(t *testing.T, stub *webhookStub) *DiscordNotifier {
+	t.Helper()
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return NewDiscordNotifier(server.URL, "vqm", nil)
+}
+
+func TestNotifySplitsOversizedMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		fields      int
+		fieldLen    int
+		wantEmbeds  int
+	}{
+		{"small message", "host is fine", 3, 10, 1},
+		{"long description", strings.Repeat("é", 2*maxDescriptionLen+10), 0, 0, 3},
+		{"too many fields", "", 2*maxFields + 1, 10, 3},
+		// 4096 + 1 field fill the first embed, 5 oversized fields fit in 6000 characters
+		{"long description and large fields", strings.Repeat("x", maxDescriptionLen), 40, maxFieldValueLen + 5, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &webhookStub{}
+			d := newTestNotifier(t, stub)
+
+			msg := Message{Title: "Disk usage", Description: tt.description, Severity: SeverityWarning}
+			for i := range tt.fields {
+				msg.Fields = append(msg.Fields, Field{Name: fmt.Sprintf("field %d", i), Value: strings.Repeat("v", tt.fieldLen)})
+			}
+			if err := d.Notify(context.Background(), msg); err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+
+			var description strings.Builder
+			embeds, fields := 0, 0
+			for _, payload := range stub.payloads {
+				if len(payload.Embeds) > maxEmbedsPerMsg {
+					t.Errorf("%d embeds in one message, limit %d", len(payload.Embeds), maxEmbedsPerMsg)
+				}
+				size := 0
+				for _, e := range payload.Embeds {
+					size += e.size()
+					embeds++
+					fields += len(e.Fields)
+					description.WriteString(e.Description)
+					if utf8.RuneCountInString(e.Description) > maxDescriptionLen {
+						t.Errorf("description of %d characters", utf8.RuneCountInString(e.Description))
+					}
+					if len(e.Fields) > maxFields {
+						t.Errorf("%d fields in one embed", len(e.Fields))
+					}
+					for _, f := range e.Fields {
+						if utf8.RuneCountInString(f.Value) > maxFieldValueLen {
+							t.Errorf("field value of %d characters", utf8.RuneCountInString(f.Value))
+						}
+					}
+					if e.Color != severityColor(SeverityWarning) || e.Timestamp == "" {
+						t.Errorf("embed without color or timestamp: %+v", e)
+					}
+				}
+				if size > maxCharsPerMsg {
+					t.Errorf("message of %d characters, limit %d", size, maxCharsPerMsg)
+				}
+			}
+
+			if embeds != tt.wantEmbeds {
+				t.Errorf("got %d embeds, want %d", embeds, tt.wantEmbeds)
+			}
+			if fields != tt.fields {
+				t.Errorf("got %d fields, want %d", fields, tt.fields)
+			}
+			if description.String() != tt.description {
+				t.Errorf("description not preserved across embeds")
+			}
+			if len(stub.payloads) > 1 && !strings.HasSuffix(stub.payloads[1].Embeds[0].Title, fmt.Sprintf("(2/%d)", len(stub.payloads))) {
+				t.Errorf("split message title %q", stub.payloads[1].Embeds[0].Title)
+			}
+		})
+	}
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		bodies     []string
+		maxRetries int
+		wantCalls  int
+		wantErr    bool
+		minWait    time.Duration
+	}{
+		{
+			name:       "retries after retry_after",
+			statuses:   []int{http.StatusTooManyRequests, http.StatusNoContent},
+			bodies:     []string{`{"message": "You are being rate limited.", "retry_after": 0.2, "global": false}`},
+			maxRetries: 3,
+			wantCalls:  2,
+			minWait:    200 * time.Millisecond,
+		},
+		{
+			name:       "gives up after max retries",
+			statuses:   []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests},
+			bodies:     []string{`{"retry_after": 0.01}`, `{"retry_after": 0.01}`, `{"retry_after": 0.01}`},
+			maxRetries: 2,
+			wantCalls:  3,
+			wantErr:    true,
+		},
+		{
+			name:       "other errors are not retried",
+			statuses:   []int{http.StatusBadRequest},
+			bodies:     []string{`{"message": "Invalid Form Body"}`},
+			maxRetries: 3,
+			wantCalls:  1,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &webhookStub{statuses: tt.statuses, bodies: tt.bodies}
+			d := newTestNotifier(t, stub)
+			d.MaxRetries = tt.maxRetries
+
+			start := time.Now()
+			err := d.Notify(context.Background(), Message{Title: "CPU", Description: "load is high"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify error %v, want error %v", err, tt.wantErr)
+			}
+			if len(stub.payloads) != tt.wantCalls {
+				t.Errorf("got %d webhook calls, want %d", len(stub.payloads), tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestNotifyRateLimitHonoursContext(t *testing.T) {
+	stub := &webhookStub{
+		statuses: []int{http.StatusTooManyRequests},
+		bodies:   []string{`{"retry_after": 30}`},
+	}
+	d := newTestNotifier(t, stub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Notify(ctx, Message{Title: "CPU"}); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		body   string
+		want   time.Duration
+	}{
+		{"body wins", "5", `{"retry_after": 1.5}`, 1500 * time.Millisecond},
+		{"header fallback", "2", `not json`, 2 * time.Second},
+		{"default", "", ``, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("Retry-After", tt.header)
+			}
+			if got := retryAfter(header, []byte(tt.body)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyCountsTaggedTitle(t *testing.T) {
+	stub := &webhookStub{}
+	d := newTestNotifier(t, stub)
+
+	// 25 fields of about 240 characters pack an embed to just below 6000, the
+	// tagged title of a split message must still fit next to them
+	msg := Message{Title: strings.Repeat("t", 200), Severity: SeverityCritical}
+	for i := range 100 {
+		msg.Fields = append(msg.Fields, Field{Name: fmt.Sprintf("field %d", i), Value: strings.Repeat("v", 232)})
+	}
+	if err := d.Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if len(stub.payloads) < 2 {
+		t.Fatalf("got %d webhook calls, want a split message", len(stub.payloads))
+	}
+	fields := 0
+	for i, payload := range stub.payloads {
+		size := 0
+		for _, e := range payload.Embeds {
+			size += e.size()
+			fields += len(e.Fields)
+		}
+		if size > maxCharsPerMsg {
+			t.Errorf("message %d of %d characters, limit %d", i+1, size, maxCharsPerMsg)
+		}
+		if want := fmt.Sprintf("(%d/%d)", i+1, len(stub.payloads)); !strings.HasSuffix(payload.Embeds[0].Title, want) {
+			t.Errorf("message %d title %q, want suffix %q", i+1, payload.Embeds[0].Title, want)
+		}
+	}
+	if fields != len(msg.Fields) {
+		t.Errorf("got %d fields, want %d", fields, len(msg.Fields))
+	}
+}
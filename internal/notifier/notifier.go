@@ -0,0 +1,51 @@
+package notifier
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+	SeverityResolved Severity = "resolved"
+)
+
+// Field is a single key/value line shown under the message
+type Field struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// Message is the transport-agnostic payload every notifier accepts
+type Message struct {
+	Title       string
+	Description string
+	Severity    Severity
+	Fields      []Field
+	Timestamp   time.Time
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Nop drops every message, used when no notifier is configured
+type Nop struct{}
+
+func (Nop) Notify(ctx context.Context, msg Message) error {
+	return nil
+}
+
+// New returns a Discord notifier when a webhook is configured and Nop otherwise
+func New(discordWebhookURL string, discordUsername string, log *slog.Logger) Notifier {
+	if discordWebhookURL == "" {
+		return Nop{}
+	}
+	return NewDiscordNotifier(discordWebhookURL, discordUsername, log)
+}
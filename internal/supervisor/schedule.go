@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type scheduled struct {
+	name     string
+	schedule cron.Schedule
+	job      func(ctx context.Context) error
+	log      *slog.Logger
+}
+
+// Scheduled wraps a job run on a cron spec ("@hourly", "0 */4 * * *") as a Component.
+// A failing run is logged and the next one still happens, it does not count as a crash.
+func Scheduled(name string, spec string, job func(ctx context.Context) error, log *slog.Logger) (Component, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q for %s: %w", spec, name, err)
+	}
+	return &scheduled{name: name, schedule: schedule, job: job, log: log}, nil
+}
+
+func (s *scheduled) Name() string {
+	return s.name
+}
+
+func (s *scheduled) Run(ctx context.Context) error {
+	for {
+		next := s.schedule.Next(time.Now())
+		s.log.Info(fmt.Sprintf("Next %s run at %s", s.name, next.Format(time.RFC3339)))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		started := time.Now()
+		if err := s.job(ctx); err != nil {
+			s.log.Error(fmt.Sprintf("%s run failed after %s: %v", s.name, time.Since(started), err))
+			continue
+		}
+		s.log.Info(fmt.Sprintf("%s run completed in %s", s.name, time.Since(started)))
+	}
+}
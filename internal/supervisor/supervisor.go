@@ -0,0 +1,208 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"vector-quant-monitor/internal/health"
+	"vector-quant-monitor/util"
+)
+
+// Component is a long-running part of the monitor. Run should block until ctx
+// is cancelled; returning earlier (with or without error) counts as a crash.
+type Component interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type State string
+
+const (
+	StateStarting   State = "starting"
+	StateRunning    State = "running"
+	StateRestarting State = "restarting"
+	StateStopped    State = "stopped"
+)
+
+type Status struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	LastExit  time.Time `json:"last_exit,omitempty"`
+}
+
+type funcComponent struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func (f funcComponent) Name() string                  { return f.name }
+func (f funcComponent) Run(ctx context.Context) error { return f.run(ctx) }
+
+// Func adapts a plain function to a Component
+func Func(name string, run func(ctx context.Context) error) Component {
+	return funcComponent{name: name, run: run}
+}
+
+type Supervisor struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// A component that ran at least this long starts again from MinBackoff
+	StableAfter    time.Duration
+	ReportInterval time.Duration
+
+	components []Component
+	mu         sync.Mutex
+	statuses   map[string]*Status
+	health     *health.Component // Carries the statuses on /healthz
+	log        *slog.Logger
+
+	// The clock, replaced in tests
+	now   func() time.Time
+	after func(d time.Duration) <-chan time.Time
+}
+
+// New supervises the components, their names must be unique
+func New(components []Component, log *slog.Logger) (*Supervisor, error) {
+	s := &Supervisor{
+		MinBackoff:     time.Second,
+		MaxBackoff:     5 * time.Minute,
+		StableAfter:    time.Minute,
+		ReportInterval: 5 * time.Minute,
+		components:     components,
+		statuses:       make(map[string]*Status),
+		health:         health.Register("supervisor", false, 0),
+		log:            log,
+		now:            time.Now,
+		after:          time.After,
+	}
+	for _, c := range components {
+		if _, ok := s.statuses[c.Name()]; ok {
+			return nil, fmt.Errorf("component %s added twice", c.Name())
+		}
+		s.statuses[c.Name()] = &Status{Name: c.Name(), State: StateStarting}
+		s.health.Set(c.Name(), *s.statuses[c.Name()])
+	}
+	return s, nil
+}
+
+// Run starts every component and blocks until ctx is cancelled and all of them returned
+func (s *Supervisor) Run(ctx context.Context) error {
+	if len(s.components) == 0 {
+		return fmt.Errorf("no components to supervise")
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range s.components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.supervise(ctx, c)
+		}()
+	}
+
+	go s.report(ctx)
+
+	wg.Wait()
+	return nil
+}
+
+// Statuses returns a snapshot sorted by component name
+func (s *Supervisor) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.statuses))
+	for _, st := range s.statuses {
+		statuses = append(statuses, *st)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+func (s *Supervisor) supervise(ctx context.Context, c Component) {
+	attempt := 0
+	for {
+		startedAt := s.now()
+		s.update(c.Name(), func(st *Status) {
+			st.State = StateRunning
+			st.StartedAt = startedAt
+		})
+		s.log.Info(fmt.Sprintf("Component %s started", c.Name()))
+
+		err := runSafely(ctx, c)
+
+		if ctx.Err() != nil {
+			s.update(c.Name(), func(st *Status) {
+				st.State = StateStopped
+				st.LastExit = s.now()
+			})
+			s.log.Info(fmt.Sprintf("Component %s stopped", c.Name()))
+			return
+		}
+
+		if s.now().Sub(startedAt) >= s.StableAfter {
+			attempt = 0
+		}
+		wait := util.Backoff(attempt, s.MinBackoff, s.MaxBackoff)
+		attempt++
+
+		if err == nil {
+			err = fmt.Errorf("returned unexpectedly")
+		}
+		s.update(c.Name(), func(st *Status) {
+			st.State = StateRestarting
+			st.Restarts++
+			st.LastError = err.Error()
+			st.LastExit = s.now()
+		})
+		s.log.Error(fmt.Sprintf("Component %s crashed, restarting in %s: %v", c.Name(), wait, err))
+
+		select {
+		case <-ctx.Done():
+			s.update(c.Name(), func(st *Status) { st.State = StateStopped })
+			return
+		case <-s.after(wait):
+		}
+	}
+}
+
+// runSafely turns a panic into an error so one component can't take down the process
+func runSafely(ctx context.Context, c Component) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Run(ctx)
+}
+
+func (s *Supervisor) update(name string, fn func(st *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.statuses[name])
+	s.health.Set(name, *s.statuses[name])
+}
+
+func (s *Supervisor) report(ctx context.Context) {
+	ticker := time.NewTicker(s.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, st := range s.Statuses() {
+				s.log.Info(fmt.Sprintf("Component %s: %s (restarts %d)", st.Name, st.State, st.Restarts))
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/health"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeClock fires every backoff at once and records how long it was
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+	return fired
+}
+
+// waitFor polls the statuses until ok accepts them
+func waitFor(t *testing.T, s *Supervisor, ok func(Status) bool) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := s.Statuses()[0]
+		if ok(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting, status %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSupervisorRestarts(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+	// Each run of the component does the next step, the last one runs until cancelled
+	steps := []func(ctx context.Context) error{
+		func(ctx context.Context) error { return errors.New("dial: connection refused") },
+		func(ctx context.Context) error { panic("nil map") },
+		func(ctx context.Context) error { return nil },
+		// Ran long enough to count as stable, the backoff starts over
+		func(ctx context.Context) error {
+			clock.Advance(2 * time.Minute)
+			return errors.New("listen key expired")
+		},
+		func(ctx context.Context) error { return errors.New("dial: connection refused") },
+		func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() },
+	}
+	runs := 0
+	flaky := Func("userstream", func(ctx context.Context) error {
+		runs++
+		return steps[min(runs, len(steps))-1](ctx)
+	})
+
+	s, err := New([]Component{flaky}, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MinBackoff = time.Second
+	s.MaxBackoff = time.Hour
+	s.now = clock.Now
+	s.after = clock.After
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	st := waitFor(t, s, func(st Status) bool { return st.Restarts == 5 && st.State == StateRunning })
+	if st.LastError != "dial: connection refused" {
+		t.Errorf("last error %q", st.LastError)
+	}
+
+	// Backoff doubles per crash with up to half of it as jitter
+	clock.mu.Lock()
+	waits := clock.waits
+	clock.mu.Unlock()
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, time.Second, 2 * time.Second}
+	if len(waits) != len(want) {
+		t.Fatalf("got waits %v, want %d", waits, len(want))
+	}
+	for i, w := range want {
+		if waits[i] < w/2 || waits[i] > w {
+			t.Errorf("wait %d: %s, want %s to %s", i, waits[i], w/2, w)
+		}
+	}
+
+	// The statuses are on /healthz
+	var details map[string]any
+	for _, c := range health.Check(context.Background()).Components {
+		if c.Name == "supervisor" {
+			details = c.Details
+		}
+	}
+	if got, ok := details["userstream"].(Status); !ok || got.Restarts != 5 || got.State != StateRunning {
+		t.Errorf("health details %+v", details)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if st := s.Statuses()[0]; st.State != StateStopped || st.Restarts != 5 {
+		t.Errorf("after shutdown %+v", st)
+	}
+}
+
+func TestSupervisorStopsDuringBackoff(t *testing.T) {
+	failing := Func("host", func(ctx context.Context) error { return errors.New("proc unreadable") })
+	s, err := New([]Component{failing}, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MinBackoff = time.Hour
+	s.MaxBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	waitFor(t, s, func(st Status) bool { return st.State == StateRestarting })
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run kept waiting out the backoff after cancel")
+	}
+	if st := s.Statuses()[0]; st.State != StateStopped || st.Restarts != 1 {
+		t.Errorf("after shutdown %+v", st)
+	}
+}
+
+func TestNewRejectsDuplicateNames(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	if _, err := New([]Component{Func("host", noop), Func("backfill", noop), Func("host", noop)}, discard); err == nil {
+		t.Error("two components named host accepted")
+	}
+
+	s, err := New(nil, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(context.Background()); err == nil {
+		t.Error("ran without components")
+	}
+}
@@ -0,0 +1,24 @@
+package vector
+
+import "vector-quant-monitor/internal/metrics"
+
+var (
+	naiveCheckAccuracy = metrics.NewGauge(
+		"vqm_naive_check_accuracy_ratio",
+		"Share of correct predictions in the last completed naive check, neighbors under the temporal embargo, by predictor.",
+		"predictor",
+	)
+	naiveCheckBaselineAccuracy = metrics.NewGauge(
+		"vqm_naive_check_baseline_accuracy_ratio",
+		"Share of correct predictions in the last naive check without the temporal embargo, by predictor.",
+		"predictor",
+	)
+	naiveCheckIterations = metrics.NewGauge(
+		"vqm_naive_check_iterations",
+		"Iterations evaluated by the last completed naive check.",
+	)
+	naiveCheckLastRun = metrics.NewGauge(
+		"vqm_naive_check_last_run_timestamp_seconds",
+		"Unix time the last naive check completed.",
+	)
+)
@@ -1,15 +1,16 @@
 package vector
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 	"vector-quant-monitor/internal/config"
 	"vector-quant-monitor/internal/db"
-
-	// "encoding/json" // No longer needed with pgvector.Vector
-	"github.com/pgvector/pgvector-go"
 )
 
 type QueryRandomRow struct {
@@ -24,193 +25,373 @@ type PatternLabel struct {
 	NextReturn float64   `json:"next_return"`
 	NextSlope3 float64   `json:"next_slope_3"`
 	NextSlope5 float64   `json:"next_slope_5"`
+	Label      float64   `json:"label"` // Value of the check's target, what the predictors vote on
 	Embedding  []float64
 	Distance   float64
 }
 
+// PredictionResult is the outcome of one predictor. The counts describe the
+// neighbors' votes whatever the predictor, NumDiffCount is their margin.
 type PredictionResult struct {
+	Predictor     string
 	PositiveCount int
 	NegativeCount int
 	IsCorrect     bool
 	NumDiffCount  float64
+	Neighbors     int // Neighbors left after filtering, the embargo may leave fewer than K
+	Predicted     int // 1 up, -1 down, 0 abstained
+	Score         float64
+}
+
+// CheckResult is the prediction of one query row with and without the
+// temporal embargo, one result per predictor in CheckOptions order
+type CheckResult struct {
+	QueryTime time.Time
+	Embargoed []PredictionResult
+	Baseline  []PredictionResult // Every neighbor except the query itself, leaks future labels
+}
+
+// CheckOptions are the knobs of the naive prediction check
+type CheckOptions struct {
+	K          int // Neighbors per prediction
+	Iterations int // Random query rows to evaluate
+
+	// Universe the naive check samples its query rows from
+	Query db.Universe
+
+	// Neighbor universe. An empty list keeps the query's own symbol or
+	// interval; listing symbols searches across symbols ("*" for any),
+	// listing intervals across intervals.
+	NeighborSymbols   []string
+	NeighborIntervals []string
+
+	// Label the neighbors vote on and the query is scored against
+	Target db.Target
+
+	// A neighbor's label looks Horizon candles ahead (0 for the target's), it
+	// is only usable once those candles closed. Embargo additionally drops the
+	// neighbors right before the query, their embedding windows overlap the query's.
+	Horizon int
+	Embargo time.Duration
+
+	// Optional train period the neighbors are taken from, zero for no limit
+	TrainFrom time.Time
+	TrainTo   time.Time
+
+	// Compared side by side on the same neighbors
+	Predictors []Predictor
 }
 
-const TotalIterations = 50
-
-// 1. Updated signature to return (PredictionResult, error) matches the return statements
-func StartNaivePredictionCheck(log *slog.Logger, k int) error {
-	config := config.LoadConfig()
-
-	dbConnectionString := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		config.Database.DBUser,
-		config.Database.DBPassword,
-		config.Database.DBHost,
-		fmt.Sprintf("%d", config.Database.DBPort),
-		config.Database.DBName,
-	)
-	db := db.NewPostgreSQLDB(
-		dbConnectionString,
-		log,
-	)
-
-	// We don't need to pass a pointer in; we can just get the result back
-	isCorrectTotal := 0
-	for i := range TotalIterations {
+func DefaultCheckOptions() CheckOptions {
+	return CheckOptions{
+		K:          21,
+		Iterations: 50,
+		Query:      db.Universe{Symbols: []string{"ETHUSDT"}, Intervals: []string{"15m"}},
+		Target:     db.TargetNextSlope5,
+		Embargo:    24 * time.Hour,
+		Predictors: []Predictor{MajorityVote{}},
+	}
+}
+
+// horizon falls back to the candles the target looks ahead
+func (o CheckOptions) horizon() int {
+	if o.Horizon > 0 {
+		return o.Horizon
+	}
+	return o.Target.Horizon()
+}
+
+// StartNaivePredictionCheck connects to the database, runs Iterations checks
+// and logs the accuracy of every predictor with and without the embargo
+func StartNaivePredictionCheck(ctx context.Context, config *config.AppConfig, opts CheckOptions, log *slog.Logger) error {
+	db, err := db.Connect(config.Database, log)
+	if err != nil {
+		return err
+	}
+	defer db.DB.Close()
+
+	embargoed := make([]evaluation, len(opts.Predictors))
+	baseline := make([]evaluation, len(opts.Predictors))
+	for i := range opts.Iterations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		log.Info(fmt.Sprintf("Naive Prediction Check Iteration: %d", i+1))
-		result, err := NaivePredictionCheck(db, log, k)
+		result, err := NaivePredictionCheck(db, log, opts)
 		if err != nil {
 			return err
 		}
 
 		log.Info(fmt.Sprintf("Final Prediction Result: %+v", result))
 
-		if result.IsCorrect {
-			isCorrectTotal++
+		for j := range opts.Predictors {
+			embargoed[j].add(result.Embargoed[j])
+			baseline[j].add(result.Baseline[j])
 		}
 	}
-	correctPercentage := (float64(isCorrectTotal) / TotalIterations) * 100.0
-	log.Info(fmt.Sprintf("Overall Correct Predictions: %d out of %d (%.2f%%)", isCorrectTotal, TotalIterations, correctPercentage))
+
+	log.Info(fmt.Sprintf("Predictors: %s on %s (queries %s, neighbors %s, horizon %d candles, embargo window %s, train period %s)",
+		predictorNames(opts.Predictors), opts.Target, universeName(opts.Query.Symbols, opts.Query.Intervals, "any"),
+		universeName(opts.NeighborSymbols, opts.NeighborIntervals, "query's"), opts.horizon(), opts.Embargo, trainPeriod(opts)))
+	for j, predictor := range opts.Predictors {
+		name := predictor.Name()
+		log.Info(fmt.Sprintf("Overall Correct Predictions of %s with embargo: %s", name, embargoed[j].summary()))
+		log.Info(fmt.Sprintf("Overall Correct Predictions of %s without embargo: %s", name, baseline[j].summary()))
+		log.Info(fmt.Sprintf("Embargo changed accuracy of %s by %+.2f points",
+			name, embargoed[j].accuracy()-baseline[j].accuracy()))
+
+		if opts.Iterations > 0 {
+			naiveCheckAccuracy.Set(embargoed[j].accuracy()/100.0, name)
+			naiveCheckBaselineAccuracy.Set(baseline[j].accuracy()/100.0, name)
+		}
+	}
+
+	if opts.Iterations > 0 {
+		naiveCheckIterations.Set(float64(opts.Iterations))
+		naiveCheckLastRun.Set(float64(time.Now().Unix()))
+	}
 	return nil
 }
 
-// 2. Removed pointer argument 'ResultPrediction', just return the struct
-func NaivePredictionCheck(db *db.Postgresql, log *slog.Logger, k int) (PredictionResult, error) {
-	resultPrediction := PredictionResult{} // Initialize the result struct
-
+// NaivePredictionCheck predicts one random query row of the Query universe
+// from its nearest neighbors, once under the embargo and once without it
+func NaivePredictionCheck(store db.PatternStore, log *slog.Logger, opts CheckOptions) (CheckResult, error) {
 	// Query 1: Get Random Row
-	query_random_row := `
-        select embedding, next_slope_5
-        from market_pattern_go TABLESAMPLE SYSTEM(0.1)
-        where close_price is not null
-            and next_return  is not null
-            and next_slope_3 is not null
-            and next_slope_5 is not null
-        order by random()
-        limit 1;
-    `
-
-	rows, err := db.DB.Query(query_random_row)
+	query, err := store.RandomPattern(opts.Query, opts.Target)
 	if err != nil {
-		return PredictionResult{}, err
+		log.Info(fmt.Sprintf("Random row error: %v", err))
+		return CheckResult{}, err
 	}
-	defer rows.Close()
+	answer := query.Label(opts.Target)
 
-	var answerSlope5 float64
-	var embeddingVec pgvector.Vector // 3. Use pgvector type directly (no JSON needed)
+	log.Info(fmt.Sprintf("Random Row %s %s at %s, Embedding (First 5): %v",
+		query.Symbol, query.Interval, query.Time.Format(time.DateTime), query.Embedding[:min(5, len(query.Embedding))]))
+	log.Info(fmt.Sprintf("With %s: %v", opts.Target, answer))
 
-	if rows.Next() {
-		if err := rows.Scan(&embeddingVec, &answerSlope5); err != nil {
-			log.Info(fmt.Sprintf("Scan error: %v", err))
-			return PredictionResult{}, err
-		}
-	} else {
-		return PredictionResult{}, fmt.Errorf("no rows found in random selection")
-	}
-
-	// Convert pgvector (float32) to float64 for your struct if needed,
-	// but we can use embeddingVec directly for the next query.
-	log.Info(fmt.Sprintf("Random Row Embedding (First 5): %v", embeddingVec.Slice()[:5]))
-	log.Info(fmt.Sprintln("With next slope_5: ", answerSlope5))
-
-	// Query 2: Find Neighbors
-	sql := `
-        SELECT 
-            time, symbol, interval, 
-            next_return, next_slope_3, next_slope_5, 
-            embedding,
-            (embedding <=> $1) as distance
-        FROM market_pattern_go
-        WHERE next_return IS NOT NULL
-            AND symbol = 'ETHUSDT'
-            AND interval = '15m'
-        ORDER BY distance ASC
-        LIMIT $2
-    `
-
-	similarRows, err := db.DB.Query(sql, embeddingVec, k)
+	// Query 2: Find Neighbors, once only from the past and once from the whole table
+	log.Info("Fetching similar rows...")
+	embargoFilter, err := EmbargoFilter(query, opts)
 	if err != nil {
-		return PredictionResult{}, err
+		return CheckResult{}, err
+	}
+	baselineFilter := NeighborFilter(query, opts)
+
+	result := CheckResult{QueryTime: query.Time}
+	for _, search := range []struct {
+		name   string
+		filter db.NeighborFilter
+		target *[]PredictionResult
+	}{
+		{"with embargo", embargoFilter, &result.Embargoed},
+		{"without embargo", baselineFilter, &result.Baseline},
+	} {
+		neighbors, err := store.NearestPatterns(query.Embedding, search.filter, opts.K)
+		if err != nil {
+			return CheckResult{}, err
+		}
+		*search.target = predict(answer, neighbors, opts.Target, opts.Predictors)
+		for _, r := range *search.target {
+			logPrediction(search.name, r, log)
+		}
 	}
-	defer similarRows.Close()
 
-	var results []PatternLabel
+	return result, nil
+}
 
-	log.Info("Fetching similar rows...")
-	for similarRows.Next() {
-		var r PatternLabel
-		var rawTime int64
-		var slope3, slope5 *float64
-		var vec pgvector.Vector
-
-		err := similarRows.Scan(
-			&rawTime, &r.Symbol, &r.Interval,
-			&r.NextReturn, &slope3, &slope5,
-			&vec,
-			&r.Distance,
-		)
+// NeighborFilter admits every neighbor of the query's neighbor universe in
+// the train period, labels known only after the query included
+func NeighborFilter(query db.Pattern, opts CheckOptions) db.NeighborFilter {
+	universe := db.Universe{Symbols: opts.NeighborSymbols, Intervals: opts.NeighborIntervals}
+	switch {
+	case len(universe.Symbols) == 0:
+		universe.Symbols = []string{query.Symbol}
+	case slices.Contains(universe.Symbols, "*"):
+		universe.Symbols = nil
+	}
+	if len(universe.Intervals) == 0 {
+		universe.Intervals = []string{query.Interval}
+	}
+	return db.NeighborFilter{
+		Universe: universe,
+		Target:   opts.Target,
+		From:     opts.TrainFrom,
+		To:       opts.TrainTo,
+	}
+}
+
+// EmbargoFilter admits the neighbors whose label was known Embargo before the
+// query candle closed. Pattern times are candle opens, a label is known
+// Horizon candles after its own candle closed. Across intervals the longest
+// neighbor candle sets the cutoff so that no label is known too late.
+func EmbargoFilter(query db.Pattern, opts CheckOptions) (db.NeighborFilter, error) {
+	filter := NeighborFilter(query, opts)
+	queryCandle, err := IntervalDuration(query.Interval)
+	if err != nil {
+		return db.NeighborFilter{}, err
+	}
+	var neighborCandle time.Duration
+	for _, interval := range filter.Intervals {
+		candle, err := IntervalDuration(interval)
 		if err != nil {
-			return PredictionResult{}, err
+			return db.NeighborFilter{}, err
 		}
+		neighborCandle = max(neighborCandle, candle)
+	}
 
-		r.Time = time.Unix(rawTime, 0).UTC()
-		if slope3 != nil {
-			r.NextSlope3 = *slope3
-		}
-		if slope5 != nil {
-			r.NextSlope5 = *slope5
-		}
+	cutoff := query.Time.Add(queryCandle - time.Duration(opts.horizon()+1)*neighborCandle - opts.Embargo)
+	if filter.To.IsZero() || cutoff.Before(filter.To) {
+		filter.To = cutoff
+	}
+	return filter, nil
+}
 
-		// Convert vector to slice for the struct
-		r.Embedding = make([]float64, len(vec.Slice()))
-		for i, v := range vec.Slice() {
-			r.Embedding[i] = float64(v)
-		}
+// IntervalDuration converts a Binance kline interval such as 15m, 4h or 1d
+func IntervalDuration(interval string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'M': 30 * 24 * time.Hour, // Calendar months vary, close enough for an embargo
+	}
+	if len(interval) < 2 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	unit, ok := units[interval[len(interval)-1]]
+	n, err := strconv.Atoi(interval[:len(interval)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// predict runs every predictor on the same neighbors, the query itself (distance 0) is left out
+func predict(answer float64, neighbors []db.Pattern, target db.Target, predictors []Predictor) []PredictionResult {
+	var labels []PatternLabel
+	for _, n := range neighbors {
+		r := toPatternLabel(n, target)
 
 		// Filter out the exact same row (distance 0)
 		if r.Distance > 0 {
-			results = append(results, r)
+			labels = append(labels, r)
 		}
 	}
+	positive, negative := voteCounts(labels)
+	actual := ActualDirection(answer)
+
+	results := make([]PredictionResult, 0, len(predictors))
+	for _, predictor := range predictors {
+		p := predictor.Predict(labels)
+		results = append(results, PredictionResult{
+			Predictor:     predictor.Name(),
+			PositiveCount: positive,
+			NegativeCount: negative,
+			NumDiffCount:  math.Abs(float64(positive) - float64(negative)),
+			Neighbors:     len(labels),
+			Predicted:     p.Direction,
+			Score:         p.Score,
+			IsCorrect:     p.Direction != 0 && p.Direction == actual,
+		})
+	}
+	return results
+}
 
-	// 4. Calculate Prediction (Optimized Loop)
-	var positiveSlope5Count int
-	var negativeSlope5Count int
+// ActualDirection of a label, a flat label counts as down like in the original check
+func ActualDirection(answer float64) int {
+	if answer > 0 {
+		return 1
+	}
+	return -1
+}
 
-	for _, res := range results {
-		if res.NextSlope5 > 0 {
-			positiveSlope5Count++
-		} else if res.NextSlope5 < 0 {
-			negativeSlope5Count++
-		}
+func logPrediction(name string, r PredictionResult, log *slog.Logger) {
+	log.Info(fmt.Sprintf("Overall Prediction %s: Positive Vs Negative (%d vs %d), %s predicts %d (score %.4g)",
+		name, r.PositiveCount, r.NegativeCount, r.Predictor, r.Predicted, r.Score))
+	switch {
+	case r.Predicted == 0:
+		log.Info("Equal Prediction, cannot decide")
+	case r.IsCorrect:
+		log.Info("Correct Prediction")
+	default:
+		log.Info("Wrong Prediction")
 	}
+}
 
-	resultPrediction.PositiveCount = positiveSlope5Count
-	resultPrediction.NegativeCount = negativeSlope5Count
+// evaluation tallies the predictions of one variant over a check run
+type evaluation struct {
+	total     int
+	correct   int
+	ties      int
+	neighbors int
+}
 
-	log.Info(fmt.Sprintf("Overall Prediction: Positive Vs Negative (%d vs %d)", positiveSlope5Count, negativeSlope5Count))
+func (e *evaluation) add(r PredictionResult) {
+	e.total++
+	e.neighbors += r.Neighbors
+	if r.IsCorrect {
+		e.correct++
+	}
+	if r.Predicted == 0 {
+		e.ties++
+	}
+}
 
-	if positiveSlope5Count == negativeSlope5Count {
-		log.Info("Equal Prediction, cannot decide")
-		return resultPrediction, nil
+// accuracy counts ties as wrong, in percent
+func (e evaluation) accuracy() float64 {
+	if e.total == 0 {
+		return 0
 	}
+	return float64(e.correct) / float64(e.total) * 100.0
+}
 
-	// Check correctness
-	isPredictionPositive := positiveSlope5Count > negativeSlope5Count
-	isAnswerPositive := answerSlope5 > 0
+func (e evaluation) summary() string {
+	meanNeighbors := 0.0
+	if e.total > 0 {
+		meanNeighbors = float64(e.neighbors) / float64(e.total)
+	}
+	return fmt.Sprintf("%d out of %d (%.2f%%), %d undecided, %.1f neighbors on average",
+		e.correct, e.total, e.accuracy(), e.ties, meanNeighbors)
+}
 
-	// Logic: If Prediction matches Answer direction
-	if (isPredictionPositive && isAnswerPositive) || (!isPredictionPositive && !isAnswerPositive) {
-		log.Info("Correct Prediction")
-		resultPrediction.IsCorrect = true
-	} else {
-		log.Info("Wrong Prediction")
-		resultPrediction.IsCorrect = false
+func trainPeriod(opts CheckOptions) string {
+	if opts.TrainFrom.IsZero() && opts.TrainTo.IsZero() {
+		return "unrestricted"
 	}
+	bound := func(t time.Time, open string) string {
+		if t.IsZero() {
+			return open
+		}
+		return t.Format("2006-01-02")
+	}
+	return bound(opts.TrainFrom, "start") + " to " + bound(opts.TrainTo, "end")
+}
 
-	// Calculate diff
-	resultPrediction.NumDiffCount = math.Abs(float64(positiveSlope5Count) - float64(negativeSlope5Count))
+// universeName describes a universe for reports, empty lists read as fallback
+func universeName(symbols []string, intervals []string, fallback string) string {
+	name := func(list []string) string {
+		if len(list) == 0 {
+			return fallback
+		}
+		return strings.Join(list, ",")
+	}
+	return name(symbols) + " " + name(intervals)
+}
 
-	// 5. Return the populated result!
-	return resultPrediction, nil
+func toPatternLabel(p db.Pattern, target db.Target) PatternLabel {
+	// Convert vector to slice for the struct
+	embedding := make([]float64, len(p.Embedding))
+	for i, v := range p.Embedding {
+		embedding[i] = float64(v)
+	}
+	return PatternLabel{
+		Time:       p.Time,
+		Symbol:     p.Symbol,
+		Interval:   p.Interval,
+		NextReturn: p.NextReturn,
+		NextSlope3: p.NextSlope3,
+		NextSlope5: p.NextSlope5,
+		Label:      p.Label(target),
+		Embedding:  embedding,
+		Distance:   p.Distance,
+	}
 }
@@ -0,0 +1,243 @@
+package vector
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/db"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var t0 = time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+
+func pattern(symbol string, at time.Time, label float64, embedding ...float32) db.Pattern {
+	return db.Pattern{
+		Time:       at,
+		Symbol:     symbol,
+		Interval:   "1h",
+		NextReturn: label,
+		NextSlope3: label,
+		NextSlope5: label,
+		Embedding:  embedding,
+	}
+}
+
+func unlabelled(p db.Pattern, targets ...db.Target) db.Pattern {
+	p.Unlabelled = targets
+	return p
+}
+
+func TestNaivePredictionCheckEmbargo(t *testing.T) {
+	store := db.NewMemoryStore()
+	store.Patterns = []db.Pattern{
+		// The only query row
+		pattern("SOLUSDT", t0, 1, 1, 0),
+		// Similar history, going up
+		pattern("ETHUSDT", t0.Add(-10*24*time.Hour), 1, 1, 0.10),
+		pattern("ETHUSDT", t0.Add(-9*24*time.Hour), 2, 1, 0.11),
+		pattern("ETHUSDT", t0.Add(-8*24*time.Hour), 3, 1, 0.12),
+		// Closest of all but its next_return isn't known yet
+		unlabelled(pattern("ETHUSDT", t0.Add(-7*24*time.Hour), 0, 1, 0.001), db.TargetNextReturn),
+		// Even closer, but from after the query: leaks the future
+		pattern("ETHUSDT", t0.Add(24*time.Hour), -1, 1, 0.01),
+		pattern("ETHUSDT", t0.Add(48*time.Hour), -1, 1, 0.02),
+	}
+
+	opts := DefaultCheckOptions()
+	opts.K = 3
+	opts.Query = db.Universe{Symbols: []string{"SOLUSDT"}, Intervals: []string{"1h"}}
+	opts.NeighborSymbols = []string{"ETHUSDT"}
+	opts.Target = db.TargetNextReturn
+	opts.Predictors = []Predictor{MajorityVote{}, WeightedVote{}}
+
+	result, err := NaivePredictionCheck(store, discard, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.QueryTime.Equal(t0) {
+		t.Fatalf("query at %s, want %s", result.QueryTime, t0)
+	}
+	for _, tt := range []struct {
+		name     string
+		results  []PredictionResult
+		positive int
+		negative int
+		correct  bool
+	}{
+		{"embargoed", result.Embargoed, 3, 0, true},
+		{"baseline", result.Baseline, 1, 2, false},
+	} {
+		if len(tt.results) != 2 {
+			t.Fatalf("%s: got %d results, want one per predictor", tt.name, len(tt.results))
+		}
+		for _, r := range tt.results {
+			if r.PositiveCount != tt.positive || r.NegativeCount != tt.negative || r.IsCorrect != tt.correct {
+				t.Errorf("%s %s: got +%d -%d correct %v, want +%d -%d correct %v", tt.name, r.Predictor,
+					r.PositiveCount, r.NegativeCount, r.IsCorrect, tt.positive, tt.negative, tt.correct)
+			}
+		}
+	}
+}
+
+func TestNaivePredictionCheckSkipsUnlabelledQueries(t *testing.T) {
+	store := db.NewMemoryStore()
+	store.Patterns = []db.Pattern{
+		unlabelled(pattern("ETHUSDT", t0, 1, 1, 0), db.TargetNextSlope5),
+		unlabelled(pattern("ETHUSDT", t0.Add(time.Hour), 1, 1, 0), db.TargetNextSlope5),
+	}
+	opts := DefaultCheckOptions()
+	opts.Query = db.Universe{Symbols: []string{"ETHUSDT"}}
+	if _, err := NaivePredictionCheck(store, discard, opts); err == nil {
+		t.Error("sampled a query row without its next_slope_5 label")
+	}
+
+	opts.Target = db.TargetNextReturn
+	if _, err := NaivePredictionCheck(store, discard, opts); err != nil {
+		t.Errorf("next_return is known: %v", err)
+	}
+}
+
+func TestEmbargoFilter(t *testing.T) {
+	query := db.Pattern{Time: t0, Symbol: "ETHUSDT", Interval: "15m"}
+	tests := []struct {
+		name      string
+		interval  string // Of the query, 15m if empty
+		intervals []string
+		target    db.Target
+		horizon   int
+		embargo   time.Duration
+		trainTo   time.Time
+		want      time.Time // Latest neighbor candle open admitted
+	}{
+		// The query candle closes at 00:15, a 15m neighbor's next_return is known 2 candles after its open
+		{name: "same interval", target: db.TargetNextReturn, want: t0.Add(15*time.Minute - 30*time.Minute)},
+		{name: "same interval with embargo", target: db.TargetNextReturn, embargo: 24 * time.Hour, want: t0.Add(-15*time.Minute - 24*time.Hour)},
+		// An hourly label is known 2 hours after the neighbor candle opened
+		{name: "1h neighbors", intervals: []string{"1h"}, target: db.TargetNextReturn, want: t0.Add(15*time.Minute - 2*time.Hour)},
+		{name: "1h neighbors, slope over 5", intervals: []string{"1h"}, target: db.TargetNextSlope5, want: t0.Add(15*time.Minute - 6*time.Hour)},
+		{name: "1h neighbors, horizon override", intervals: []string{"1h"}, target: db.TargetNextSlope5, horizon: 2, want: t0.Add(15*time.Minute - 3*time.Hour)},
+		{
+			name:      "1h neighbors with embargo",
+			intervals: []string{"1h"},
+			target:    db.TargetNextReturn,
+			embargo:   12 * time.Hour,
+			want:      t0.Add(15*time.Minute - 2*time.Hour - 12*time.Hour),
+		},
+		// The longest neighbor candle decides for every interval
+		{name: "mixed neighbors", intervals: []string{"15m", "4h"}, target: db.TargetNextReturn, want: t0.Add(15*time.Minute - 8*time.Hour)},
+		// A daily query against hourly neighbors, the cutoff is after the query open
+		{name: "1d query, 1h neighbors", interval: "1d", intervals: []string{"1h"}, target: db.TargetNextReturn, want: t0.Add(22 * time.Hour)},
+		{name: "earlier train end", intervals: []string{"1h"}, target: db.TargetNextReturn, trainTo: t0.Add(-48 * time.Hour), want: t0.Add(-48 * time.Hour)},
+		{name: "later train end", intervals: []string{"1h"}, target: db.TargetNextReturn, trainTo: t0, want: t0.Add(15*time.Minute - 2*time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := query
+			if tt.interval != "" {
+				q.Interval = tt.interval
+			}
+			opts := DefaultCheckOptions()
+			opts.NeighborIntervals = tt.intervals
+			opts.Target = tt.target
+			opts.Horizon = tt.horizon
+			opts.Embargo = tt.embargo
+			opts.TrainTo = tt.trainTo
+
+			filter, err := EmbargoFilter(q, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !filter.To.Equal(tt.want) {
+				t.Errorf("admits up to %s, want %s", filter.To, tt.want)
+			}
+			wantIntervals := tt.intervals
+			if wantIntervals == nil {
+				wantIntervals = []string{q.Interval}
+			}
+			if !slices.Equal(filter.Intervals, wantIntervals) || !slices.Equal(filter.Symbols, []string{"ETHUSDT"}) || filter.Target != tt.target {
+				t.Errorf("filter %+v", filter)
+			}
+		})
+	}
+
+	opts := DefaultCheckOptions()
+	opts.NeighborIntervals = []string{"1h", "1x"}
+	if _, err := EmbargoFilter(query, opts); err == nil {
+		t.Error("no error for an unknown neighbor interval")
+	}
+}
+
+func TestIntervalDuration(t *testing.T) {
+	for interval, want := range map[string]time.Duration{
+		"1m":  time.Minute,
+		"15m": 15 * time.Minute,
+		"4h":  4 * time.Hour,
+		"1d":  24 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+		"1M":  30 * 24 * time.Hour,
+	} {
+		if got, err := IntervalDuration(interval); err != nil || got != want {
+			t.Errorf("%s: got %s, %v, want %s", interval, got, err, want)
+		}
+	}
+	for _, interval := range []string{"", "h", "0h", "-1h", "1x", "1.5h"} {
+		if got, err := IntervalDuration(interval); err == nil {
+			t.Errorf("%q: accepted as %s", interval, got)
+		}
+	}
+}
+
+func TestRunWalkForward(t *testing.T) {
+	// Two clusters taking turns every hour, up on [1, x] and down on [x, 1]
+	store := db.NewMemoryStore()
+	for i := range 10 {
+		at := t0.Add(time.Duration(i) * time.Hour)
+		x := float32(i) / 100
+		if i%2 == 0 {
+			store.Patterns = append(store.Patterns, pattern("ETHUSDT", at, 1, 1, x))
+		} else {
+			store.Patterns = append(store.Patterns, pattern("ETHUSDT", at, -1, x, 1))
+		}
+	}
+	// The last candle's label isn't known yet, it is no query row
+	store.Patterns = append(store.Patterns, unlabelled(pattern("ETHUSDT", t0.Add(10*time.Hour), 0, 1, 0.1), db.TargetNextReturn))
+
+	opts := BacktestOptions{
+		CheckOptions: DefaultCheckOptions(),
+		Symbol:       "ETHUSDT",
+		Interval:     "1h",
+		From:         t0,
+		To:           t0.Add(24 * time.Hour),
+	}
+	opts.K = 1
+	opts.Target = db.TargetNextReturn
+	opts.Embargo = 0
+
+	backtest, err := RunWalkForward(t.Context(), store, opts, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first row has no history and the second only the other cluster
+	summary := backtest.Results[0].Summary
+	if summary.QueryRows != 10 || summary.Predictions != 9 || summary.Correct != 8 {
+		t.Errorf("got %d rows, %d predictions, %d correct, want 10, 9, 8",
+			summary.QueryRows, summary.Predictions, summary.Correct)
+	}
+	if len(store.Evaluations) != 1 || backtest.RunID != 1 || len(store.Predictions[1]) != 10 {
+		t.Fatalf("stored %d runs with %d predictions", len(store.Evaluations), len(store.Predictions[1]))
+	}
+	// A neighbor's label is known once the candle after it closed, the row
+	// right before the query is the latest one usable
+	first, second := store.Predictions[1][0], store.Predictions[1][1]
+	if first.Neighbors != 0 || first.Predicted != 0 {
+		t.Errorf("first row predicted %d from %d neighbors, want an abstention", first.Predicted, first.Neighbors)
+	}
+	if second.Neighbors != 1 || second.Predicted != 1 {
+		t.Errorf("second row predicted %d from %d neighbors, want up from the first row", second.Predicted, second.Neighbors)
+	}
+}
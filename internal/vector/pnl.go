@@ -0,0 +1,158 @@
+package vector
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+)
+
+// PnlOptions turn every confident prediction into a position held for one
+// candle: opened at the query candle's close, closed after next_return
+type PnlOptions struct {
+	Leverage   float64
+	FeeRate    float64 // Per side, fraction of the notional
+	Slippage   float64 // Per side, fraction of the price
+	MinNumDiff int     // Trade only when NumDiffCount reaches this
+}
+
+// DefaultPnlOptions trade at the configured leverage with taker fees
+func DefaultPnlOptions(cfg config.BinanceMarketConfig) PnlOptions {
+	return PnlOptions{
+		Leverage:   float64(cfg.Leverage),
+		FeeRate:    cfg.TakerFee,
+		Slippage:   0.0002,
+		MinNumDiff: 1,
+	}
+}
+
+// SimulatePnl replays the predictions of a run in time order on an equity of
+// 1. Returns, fees and slippage scale with the leverage, an equity that falls
+// to zero stays liquidated. Sharpe and Sortino are annualized from the
+// per-candle returns, flat candles count as zero.
+func SimulatePnl(predictions []db.EvaluationPrediction, interval string, opts PnlOptions) (db.EvaluationPnl, []db.EquityPoint, error) {
+	candle, err := IntervalDuration(interval)
+	if err != nil {
+		return db.EvaluationPnl{}, nil, err
+	}
+	periodsPerYear := float64(365*24*time.Hour) / float64(candle)
+
+	pnl := db.EvaluationPnl{
+		Leverage:    opts.Leverage,
+		FeeRate:     opts.FeeRate,
+		Slippage:    opts.Slippage,
+		MinNumDiff:  opts.MinNumDiff,
+		FinalEquity: 1,
+	}
+	curve := make([]db.EquityPoint, 0, len(predictions))
+	returns := make([]float64, 0, len(predictions))
+	// Entry and exit both pay the fee and the slippage
+	cost := opts.Leverage * 2 * (opts.FeeRate + opts.Slippage)
+
+	equity, peak := 1.0, 1.0
+	for _, p := range predictions {
+		point := db.EquityPoint{Time: p.Time}
+
+		if p.Predicted != 0 && p.NumDiffCount >= opts.MinNumDiff && equity > 0 {
+			point.Position = p.Predicted
+			point.PeriodReturn = max(opts.Leverage*float64(p.Predicted)*p.NextReturn-cost, -1)
+			pnl.Trades++
+			if point.PeriodReturn > 0 {
+				pnl.WinningTrades++
+			}
+			pnl.Fees += equity * min(cost, 1)
+			equity *= 1 + point.PeriodReturn
+		}
+
+		peak = max(peak, equity)
+		point.Equity = equity
+		point.Drawdown = (peak - equity) / peak
+		pnl.MaxDrawdown = max(pnl.MaxDrawdown, point.Drawdown)
+
+		returns = append(returns, point.PeriodReturn)
+		curve = append(curve, point)
+	}
+
+	pnl.FinalEquity = equity
+	pnl.Sharpe, pnl.Sortino = riskRatios(returns, periodsPerYear)
+	return pnl, curve, nil
+}
+
+// riskRatios are NaN when the returns carry no risk to divide by
+func riskRatios(returns []float64, periodsPerYear float64) (sharpe float64, sortino float64) {
+	if len(returns) < 2 {
+		return math.NaN(), math.NaN()
+	}
+	var sum float64
+	for _, r := range returns {
+		sum += r
+	}
+	mean := sum / float64(len(returns))
+
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+
+	sharpe, sortino = math.NaN(), math.NaN()
+	if std > 0 {
+		sharpe = mean / std * math.Sqrt(periodsPerYear)
+	}
+	if downsideDev > 0 {
+		sortino = mean / downsideDev * math.Sqrt(periodsPerYear)
+	}
+	return sharpe, sortino
+}
+
+// RunPnl simulates the predictions of every predictor of a stored run and
+// keeps the results with their equity curves
+func RunPnl(store db.EvaluationStore, b Backtest, interval string, opts PnlOptions, log *slog.Logger) ([]db.EvaluationPnl, error) {
+	var pnls []db.EvaluationPnl
+	for _, r := range b.Results {
+		pnl, curve, err := SimulatePnl(r.Predictions, interval, opts)
+		if err != nil {
+			return nil, err
+		}
+		pnl.RunID = b.RunID
+		pnl.Predictor = r.Predictor
+
+		id, err := store.InsertEvaluationPnl(pnl, curve)
+		if err != nil {
+			return nil, fmt.Errorf("storing PnL simulation of %s: %w", r.Predictor, err)
+		}
+		log.Info(fmt.Sprintf("PnL simulation %d of run %d, %s: %d trades, equity %.4f, max drawdown %.2f%%",
+			id, b.RunID, r.Predictor, pnl.Trades, pnl.FinalEquity, pnl.MaxDrawdown*100))
+		pnls = append(pnls, pnl)
+	}
+	return pnls, nil
+}
+
+// WritePnlTable prints the simulations side by side for a human at the terminal
+func WritePnlTable(w io.Writer, pnls []db.EvaluationPnl) error {
+	if len(pnls) == 0 {
+		return nil
+	}
+	first := pnls[0]
+	title := fmt.Sprintf("PnL simulation of run %d: %.0fx, fee %.4f%%, slippage %.4f%% per side, min NumDiffCount %d",
+		first.RunID, first.Leverage, first.FeeRate*100, first.Slippage*100, first.MinNumDiff)
+	t := newComparisonTable(title, pnls, func(p db.EvaluationPnl) string { return p.Predictor })
+
+	t.row("Trades", func(p db.EvaluationPnl) string { return fmt.Sprint(p.Trades) })
+	t.row("Winning", func(p db.EvaluationPnl) string { return percent(ratio(p.WinningTrades, p.Trades)) })
+	t.row("Final equity", func(p db.EvaluationPnl) string { return fmt.Sprintf("%.4f", p.FinalEquity) })
+	t.row("Return", func(p db.EvaluationPnl) string { return percent(p.FinalEquity - 1) })
+	t.row("Max drawdown", func(p db.EvaluationPnl) string { return percent(p.MaxDrawdown) })
+	t.row("Sharpe (annual)", func(p db.EvaluationPnl) string { return fmt.Sprintf("%.2f", p.Sharpe) })
+	t.row("Sortino (annual)", func(p db.EvaluationPnl) string { return fmt.Sprintf("%.2f", p.Sortino) })
+	t.row("Fees and slippage", func(p db.EvaluationPnl) string { return fmt.Sprintf("%.4f", p.Fees) })
+	return t.write(w)
+}
@@ -0,0 +1,140 @@
+package vector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"vector-quant-monitor/internal/db"
+)
+
+// candle is the prediction of the i-th hourly candle, nextReturn is what the price did
+func candle(i int, predicted int, numDiff int, nextReturn float64) db.EvaluationPrediction {
+	return db.EvaluationPrediction{
+		Time:         t0.Add(time.Duration(i) * time.Hour),
+		Predicted:    predicted,
+		NumDiffCount: numDiff,
+		NextReturn:   nextReturn,
+	}
+}
+
+func closeTo(got float64, want float64) bool {
+	if math.IsNaN(want) {
+		return math.IsNaN(got)
+	}
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestSimulatePnl(t *testing.T) {
+	tenX := PnlOptions{Leverage: 10, FeeRate: 0.0004, Slippage: 0.0001, MinNumDiff: 1}
+
+	tests := []struct {
+		name        string
+		predictions []db.EvaluationPrediction
+		opts        PnlOptions
+		// Equity after every candle
+		equity      []float64
+		trades      int
+		winning     int
+		maxDrawdown float64
+		fees        float64
+	}{
+		{
+			// Cost is 10 * 2 * (0.0004 + 0.0001) = 1% of equity per trade
+			name:        "long and short at 10x pay the leveraged cost",
+			predictions: []db.EvaluationPrediction{candle(0, 1, 3, 0.02), candle(1, -1, 3, 0.01)},
+			opts:        tenX,
+			equity:      []float64{1.19, 1.19 * 0.89},
+			trades:      2,
+			winning:     1,
+			maxDrawdown: 0.11,
+			fees:        0.01 + 1.19*0.01,
+		},
+		{
+			name: "a -15% move at 10x liquidates and stays at zero",
+			predictions: []db.EvaluationPrediction{
+				candle(0, 1, 3, -0.15),
+				candle(1, 1, 3, 0.05),
+				candle(2, -1, 3, -0.05),
+			},
+			opts:        PnlOptions{Leverage: 10, MinNumDiff: 1},
+			equity:      []float64{0, 0, 0},
+			trades:      1,
+			maxDrawdown: 1,
+		},
+		{
+			name: "abstentions and weak votes stay flat",
+			predictions: []db.EvaluationPrediction{
+				candle(0, 0, 0, 0.03),
+				candle(1, 1, 2, 0.03),
+				candle(2, -1, 5, -0.01),
+			},
+			opts:    PnlOptions{Leverage: 2, MinNumDiff: 3},
+			equity:  []float64{1, 1, 1.02},
+			trades:  1,
+			winning: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pnl, curve, err := SimulatePnl(tt.predictions, "1h", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(curve) != len(tt.equity) {
+				t.Fatalf("got %d equity points, want %d", len(curve), len(tt.equity))
+			}
+			for i, want := range tt.equity {
+				if !closeTo(curve[i].Equity, want) || !curve[i].Time.Equal(tt.predictions[i].Time) {
+					t.Errorf("candle %d: equity %v at %s, want %v", i, curve[i].Equity, curve[i].Time, want)
+				}
+			}
+			if pnl.Trades != tt.trades || pnl.WinningTrades != tt.winning {
+				t.Errorf("got %d trades, %d winning, want %d, %d", pnl.Trades, pnl.WinningTrades, tt.trades, tt.winning)
+			}
+			if !closeTo(pnl.FinalEquity, tt.equity[len(tt.equity)-1]) || !closeTo(pnl.MaxDrawdown, tt.maxDrawdown) || !closeTo(pnl.Fees, tt.fees) {
+				t.Errorf("final equity %v, max drawdown %v, fees %v, want %v, %v, %v",
+					pnl.FinalEquity, pnl.MaxDrawdown, pnl.Fees, tt.equity[len(tt.equity)-1], tt.maxDrawdown, tt.fees)
+			}
+		})
+	}
+
+	if _, _, err := SimulatePnl(nil, "1x", tenX); err == nil {
+		t.Error("no error for an unknown interval")
+	}
+}
+
+func TestSimulatePnlLiquidationCap(t *testing.T) {
+	pnl, curve, err := SimulatePnl([]db.EvaluationPrediction{candle(0, -1, 3, 0.5)}, "1h", PnlOptions{Leverage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A short into +50% at 10x loses 5x the margin, but never more than all of it
+	if curve[0].PeriodReturn != -1 || curve[0].Position != -1 || pnl.FinalEquity != 0 {
+		t.Errorf("got %+v, final equity %v", curve[0], pnl.FinalEquity)
+	}
+}
+
+func TestRiskRatios(t *testing.T) {
+	tests := []struct {
+		name           string
+		returns        []float64
+		periodsPerYear float64
+		sharpe         float64
+		sortino        float64
+	}{
+		{"single candle", []float64{0.01}, 1, math.NaN(), math.NaN()},
+		{"flat", []float64{0, 0, 0}, 1, math.NaN(), math.NaN()},
+		{"no losing candle", []float64{0.02, 0}, 1, 1 / math.Sqrt2, math.NaN()},
+		// Mean 0.01, std 0.02*sqrt(2), downside deviation 0.01/sqrt(2), scaled by sqrt(4)
+		{"annualized", []float64{0.03, -0.01}, 4, 2 * 0.01 / (0.02 * math.Sqrt2), 2 * 0.01 / (0.01 / math.Sqrt2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sharpe, sortino := riskRatios(tt.returns, tt.periodsPerYear)
+			if !closeTo(sharpe, tt.sharpe) || !closeTo(sortino, tt.sortino) {
+				t.Errorf("got sharpe %v, sortino %v, want %v, %v", sharpe, sortino, tt.sharpe, tt.sortino)
+			}
+		})
+	}
+}
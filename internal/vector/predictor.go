@@ -0,0 +1,197 @@
+package vector
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Predictor turns the neighbors of a query into a direction of the target
+// Label. Neighbors come sorted by distance with the query itself already removed.
+type Predictor interface {
+	Name() string
+	Predict(neighbors []PatternLabel) Prediction
+}
+
+// Prediction is 1 up, -1 down or 0 when the predictor abstains
+type Prediction struct {
+	Direction int
+	Score     float64 // Signed strength: vote margin or expected label
+}
+
+// PredictorParams are the knobs of the predictors that have any
+type PredictorParams struct {
+	KernelBandwidth    float64 // Cosine distance, 0 uses the distance of the farthest neighbor
+	CutoffDistance     float64 // Neighbors farther away are ignored by the cutoff predictor
+	CutoffMinNeighbors int     // The cutoff predictor abstains with fewer close neighbors
+}
+
+func DefaultPredictorParams() PredictorParams {
+	return PredictorParams{
+		CutoffDistance:     0.1,
+		CutoffMinNeighbors: 5,
+	}
+}
+
+// PredictorNames lists what ParsePredictors accepts
+var PredictorNames = []string{"majority", "weighted", "kernel", "cutoff"}
+
+// ParsePredictors builds the predictors of a comma separated list such as "majority,kernel"
+func ParsePredictors(list string, params PredictorParams) ([]Predictor, error) {
+	var predictors []Predictor
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case "majority":
+			predictors = append(predictors, MajorityVote{})
+		case "weighted":
+			predictors = append(predictors, WeightedVote{})
+		case "kernel":
+			predictors = append(predictors, KernelRegression{Bandwidth: params.KernelBandwidth})
+		case "cutoff":
+			predictors = append(predictors, DistanceCutoff{
+				MaxDistance:  params.CutoffDistance,
+				MinNeighbors: params.CutoffMinNeighbors,
+				Inner:        MajorityVote{},
+			})
+		default:
+			return nil, fmt.Errorf("unknown predictor %q, expected one of %s", name, strings.Join(PredictorNames, ", "))
+		}
+	}
+	if len(predictors) == 0 {
+		return nil, fmt.Errorf("no predictor given")
+	}
+	return predictors, nil
+}
+
+// MajorityVote counts rising against falling labels, the original naive check
+type MajorityVote struct{}
+
+func (MajorityVote) Name() string { return "majority" }
+
+func (MajorityVote) Predict(neighbors []PatternLabel) Prediction {
+	positive, negative := voteCounts(neighbors)
+	if len(neighbors) == 0 {
+		return Prediction{}
+	}
+	return Prediction{
+		Direction: sign(float64(positive - negative)),
+		Score:     float64(positive-negative) / float64(len(neighbors)),
+	}
+}
+
+// WeightedVote weighs every vote by the inverse of its distance
+type WeightedVote struct{}
+
+func (WeightedVote) Name() string { return "weighted" }
+
+func (WeightedVote) Predict(neighbors []PatternLabel) Prediction {
+	var votes, total float64
+	for _, n := range neighbors {
+		// Distances of near duplicates get close to 0, keep the weight finite
+		w := 1 / math.Max(n.Distance, 1e-9)
+		votes += w * float64(sign(n.Label))
+		total += w
+	}
+	if total == 0 {
+		return Prediction{}
+	}
+	score := votes / total
+	return Prediction{Direction: sign(score), Score: score}
+}
+
+// KernelRegression estimates the expected label as the Gaussian kernel
+// weighted mean of the neighbors' labels and predicts its sign, with the
+// next_return target that is the expected return
+type KernelRegression struct {
+	Bandwidth float64 // 0 adapts to the distance of the farthest neighbor
+}
+
+func (KernelRegression) Name() string { return "kernel" }
+
+func (k KernelRegression) Predict(neighbors []PatternLabel) Prediction {
+	if len(neighbors) == 0 {
+		return Prediction{}
+	}
+	bandwidth := k.Bandwidth
+	if bandwidth <= 0 {
+		for _, n := range neighbors {
+			bandwidth = math.Max(bandwidth, n.Distance)
+		}
+	}
+	if bandwidth <= 0 {
+		return Prediction{}
+	}
+
+	var weighted, total float64
+	for _, n := range neighbors {
+		u := n.Distance / bandwidth
+		w := math.Exp(-u * u / 2)
+		weighted += w * n.Label
+		total += w
+	}
+	if total == 0 {
+		return Prediction{}
+	}
+	expected := weighted / total
+	return Prediction{Direction: sign(expected), Score: expected}
+}
+
+// DistanceCutoff only lets Inner see neighbors within MaxDistance and
+// abstains when fewer than MinNeighbors are that close
+type DistanceCutoff struct {
+	MaxDistance  float64
+	MinNeighbors int
+	Inner        Predictor
+}
+
+func (DistanceCutoff) Name() string { return "cutoff" }
+
+func (c DistanceCutoff) Predict(neighbors []PatternLabel) Prediction {
+	near := make([]PatternLabel, 0, len(neighbors))
+	for _, n := range neighbors {
+		if n.Distance <= c.MaxDistance {
+			near = append(near, n)
+		}
+	}
+	if len(near) == 0 || len(near) < c.MinNeighbors {
+		return Prediction{}
+	}
+	return c.Inner.Predict(near)
+}
+
+func voteCounts(neighbors []PatternLabel) (positive int, negative int) {
+	for _, n := range neighbors {
+		if n.Label > 0 {
+			positive++
+		} else if n.Label < 0 {
+			negative++
+		}
+	}
+	return positive, negative
+}
+
+func sign(v float64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// predictorNames joins the names for reports
+func predictorNames(predictors []Predictor) string {
+	names := make([]string, len(predictors))
+	for i, p := range predictors {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ", ")
+}
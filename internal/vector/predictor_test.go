@@ -0,0 +1,109 @@
+package vector
+
+import (
+	"math"
+	"testing"
+)
+
+// neighbor is a labelled neighbor at a cosine distance
+func neighbor(distance float64, label float64) PatternLabel {
+	return PatternLabel{Distance: distance, Label: label}
+}
+
+func TestPredictors(t *testing.T) {
+	// Two close neighbors going up, two far ones going down
+	split := []PatternLabel{neighbor(0.01, 0.2), neighbor(0.02, 0.1), neighbor(0.3, -0.5), neighbor(0.4, -0.4)}
+
+	tests := []struct {
+		name      string
+		predictor Predictor
+		neighbors []PatternLabel
+		direction int
+		score     float64
+	}{
+		{"majority without neighbors", MajorityVote{}, nil, 0, 0},
+		{"majority counts votes", MajorityVote{}, []PatternLabel{neighbor(0.1, 1), neighbor(0.1, 2), neighbor(0.1, -1)}, 1, 1.0 / 3},
+		{"majority tie", MajorityVote{}, split, 0, 0},
+		{"weighted breaks the tie toward the closer votes", WeightedVote{}, split, 1, (100 + 50 - 1/0.3 - 2.5) / (100 + 50 + 1/0.3 + 2.5)},
+		{"weighted without neighbors", WeightedVote{}, nil, 0, 0},
+		// A zero distance would divide by zero, the near duplicate outweighs everyone else
+		{"weighted zero distance", WeightedVote{}, []PatternLabel{neighbor(0, -1), neighbor(0.01, 1), neighbor(0.02, 1)}, -1, (-1e9 + 150) / (1e9 + 150)},
+		{"weighted zero distances cancel out", WeightedVote{}, []PatternLabel{neighbor(0, -1), neighbor(0, 1)}, 0, 0},
+		// The far loss is larger but barely weighs within the bandwidth
+		{
+			"kernel weights labels by distance",
+			KernelRegression{Bandwidth: 0.1},
+			[]PatternLabel{neighbor(0, 0.01), neighbor(0.4, -1)},
+			1,
+			(0.01 - math.Exp(-8)) / (1 + math.Exp(-8)),
+		},
+		{
+			"kernel is the mean label with a wide bandwidth",
+			KernelRegression{Bandwidth: 1e6},
+			[]PatternLabel{neighbor(0, 0.01), neighbor(0.4, -1)},
+			-1,
+			-0.495,
+		},
+		{
+			"kernel adapts to the farthest neighbor",
+			KernelRegression{},
+			[]PatternLabel{neighbor(0.1, -1), neighbor(0.2, 1)},
+			-1,
+			(-math.Exp(-0.125) + math.Exp(-0.5)) / (math.Exp(-0.125) + math.Exp(-0.5)),
+		},
+		{"kernel abstains on identical patterns", KernelRegression{}, []PatternLabel{neighbor(0, 1), neighbor(0, 1)}, 0, 0},
+		{"kernel without neighbors", KernelRegression{}, nil, 0, 0},
+		{
+			"cutoff votes among the close neighbors",
+			DistanceCutoff{MaxDistance: 0.05, MinNeighbors: 2, Inner: MajorityVote{}},
+			split,
+			1,
+			1,
+		},
+		{
+			"cutoff abstains with too few close neighbors",
+			DistanceCutoff{MaxDistance: 0.05, MinNeighbors: 3, Inner: MajorityVote{}},
+			split,
+			0,
+			0,
+		},
+		{
+			"cutoff abstains without close neighbors",
+			DistanceCutoff{MaxDistance: 0.001, Inner: MajorityVote{}},
+			split,
+			0,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.predictor.Predict(tt.neighbors)
+			if got.Direction != tt.direction || math.IsNaN(got.Score) || math.Abs(got.Score-tt.score) > 1e-9 {
+				t.Errorf("got %+v, want direction %d score %v", got, tt.direction, tt.score)
+			}
+		})
+	}
+}
+
+func TestParsePredictors(t *testing.T) {
+	params := PredictorParams{KernelBandwidth: 0.2, CutoffDistance: 0.05, CutoffMinNeighbors: 3}
+	predictors, err := ParsePredictors(" kernel,majority,kernel,cutoff ", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := predictorNames(predictors); names != "kernel, majority, cutoff" {
+		t.Errorf("got %s", names)
+	}
+	if k := predictors[0].(KernelRegression); k.Bandwidth != 0.2 {
+		t.Errorf("kernel bandwidth %v", k.Bandwidth)
+	}
+	if c := predictors[2].(DistanceCutoff); c.MaxDistance != 0.05 || c.MinNeighbors != 3 {
+		t.Errorf("cutoff %+v", c)
+	}
+
+	for _, list := range []string{"", " , ", "majority,knn"} {
+		if _, err := ParsePredictors(list, params); err == nil {
+			t.Errorf("%q: no error", list)
+		}
+	}
+}
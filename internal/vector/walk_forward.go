@@ -0,0 +1,419 @@
+package vector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"vector-quant-monitor/internal/config"
+	"vector-quant-monitor/internal/db"
+)
+
+// NumDiffCount buckets of the summary are this wide: 0, 1-4, 5-8, ...
+const confidenceBucketWidth = 4
+
+// BacktestOptions predict every Symbol/Interval pattern of [From, To] in time
+// order, the neighbors follow the universe, embargo and train period of
+// CheckOptions. CheckOptions.Query is not used.
+type BacktestOptions struct {
+	CheckOptions
+	Symbol   string
+	Interval string
+	From     time.Time
+	To       time.Time
+	Pnl      *PnlOptions // Also simulate trading the predictions when set
+}
+
+// BacktestStore reads the patterns and keeps the result of the run
+type BacktestStore interface {
+	db.PatternStore
+	db.EvaluationStore
+}
+
+// ConfusionMatrix counts query rows by predicted direction (none on a tie) and actual direction
+type ConfusionMatrix struct {
+	UpUp     int `json:"predicted_up_actual_up"`
+	UpDown   int `json:"predicted_up_actual_down"`
+	DownUp   int `json:"predicted_down_actual_up"`
+	DownDown int `json:"predicted_down_actual_down"`
+	NoneUp   int `json:"predicted_none_actual_up"`
+	NoneDown int `json:"predicted_none_actual_down"`
+}
+
+type DirectionScore struct {
+	Predicted int     `json:"predicted"`
+	Actual    int     `json:"actual"`
+	Precision float64 `json:"precision"` // Correct share of the predictions in this direction
+	Recall    float64 `json:"recall"`    // Share of the rows moving this way that were predicted so, ties are misses
+}
+
+type ConfidenceBucket struct {
+	Label       string  `json:"label"` // NumDiffCount range, e.g. "5-8"
+	Predictions int     `json:"predictions"`
+	Correct     int     `json:"correct"`
+	HitRate     float64 `json:"hit_rate"`
+
+	index int
+}
+
+type BacktestSummary struct {
+	QueryRows     int                `json:"query_rows"`
+	Predictions   int                `json:"predictions"` // Query rows the predictor didn't abstain on
+	Correct       int                `json:"correct"`
+	HitRate       float64            `json:"hit_rate"` // Correct share of the predictions
+	Coverage      float64            `json:"coverage"` // Share of the query rows with a prediction
+	MeanNeighbors float64            `json:"mean_neighbors"`
+	Up            DirectionScore     `json:"up"`
+	Down          DirectionScore     `json:"down"`
+	Confusion     ConfusionMatrix    `json:"confusion"`
+	Buckets       []ConfidenceBucket `json:"buckets"`
+}
+
+// PredictorBacktest is the outcome of one predictor over the run
+type PredictorBacktest struct {
+	Predictor   string
+	Summary     BacktestSummary
+	Predictions []db.EvaluationPrediction
+}
+
+type Backtest struct {
+	RunID   int64
+	Results []PredictorBacktest // In the order of CheckOptions.Predictors
+}
+
+// StartWalkForward connects to the database, runs the backtest and the
+// optional PnL simulation and writes their summary tables to out
+func StartWalkForward(ctx context.Context, config *config.AppConfig, opts BacktestOptions, out io.Writer, log *slog.Logger) error {
+	store, err := db.Connect(config.Database, log)
+	if err != nil {
+		return err
+	}
+	defer store.DB.Close()
+
+	result, err := RunWalkForward(ctx, store, opts, log)
+	if err != nil {
+		return err
+	}
+	if err := WriteBacktestTable(out, result); err != nil {
+		return err
+	}
+	if opts.Pnl == nil {
+		return nil
+	}
+
+	pnls, err := RunPnl(store, result, opts.Interval, *opts.Pnl, log)
+	if err != nil {
+		return err
+	}
+	return WritePnlTable(out, pnls)
+}
+
+// RunWalkForward predicts every pattern of the range from the history before
+// it with every predictor and stores the run in evaluation_run
+func RunWalkForward(ctx context.Context, store BacktestStore, opts BacktestOptions, log *slog.Logger) (Backtest, error) {
+	started := time.Now()
+
+	// 1. Query rows in time order
+	patterns, err := store.PatternsBetween(opts.Symbol, opts.Interval, opts.Target, opts.From, opts.To)
+	if err != nil {
+		return Backtest{}, err
+	}
+	log.Info(fmt.Sprintf("Walk-forward over %d %s %s patterns from %s to %s with %s on %s, neighbors %s",
+		len(patterns), opts.Symbol, opts.Interval, opts.From.Format(time.DateOnly), opts.To.Format(time.DateOnly),
+		predictorNames(opts.Predictors), opts.Target, universeName(opts.NeighborSymbols, opts.NeighborIntervals, "query's")))
+
+	// 2. Predict each row from the neighbors whose label was known by then
+	results := make([]PredictorBacktest, len(opts.Predictors))
+	for j, predictor := range opts.Predictors {
+		results[j] = PredictorBacktest{
+			Predictor:   predictor.Name(),
+			Predictions: make([]db.EvaluationPrediction, 0, len(patterns)),
+		}
+	}
+	correct := 0
+	for i, query := range patterns {
+		if err := ctx.Err(); err != nil {
+			return Backtest{}, err
+		}
+		filter, err := EmbargoFilter(query, opts.CheckOptions)
+		if err != nil {
+			return Backtest{}, err
+		}
+		neighbors, err := store.NearestPatterns(query.Embedding, filter, opts.K)
+		if err != nil {
+			return Backtest{}, err
+		}
+		answer := query.Label(opts.Target)
+		for j, r := range predict(answer, neighbors, opts.Target, opts.Predictors) {
+			if j == 0 && r.IsCorrect {
+				correct++
+			}
+			results[j].Predictions = append(results[j].Predictions, db.EvaluationPrediction{
+				Predictor:     r.Predictor,
+				Time:          query.Time,
+				Predicted:     r.Predicted,
+				Actual:        ActualDirection(answer),
+				PositiveCount: r.PositiveCount,
+				NegativeCount: r.NegativeCount,
+				NumDiffCount:  int(r.NumDiffCount),
+				Neighbors:     r.Neighbors,
+				Score:         r.Score,
+				NextReturn:    query.NextReturn,
+			})
+		}
+
+		if (i+1)%1000 == 0 {
+			log.Info(fmt.Sprintf("Walk-forward: %d/%d rows, %d correct so far by %s",
+				i+1, len(patterns), correct, results[0].Predictor))
+		}
+	}
+
+	// 3. Summarize and store the run
+	run := db.EvaluationRun{
+		Kind:       "walk_forward",
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		Symbol:     opts.Symbol,
+		Interval:   opts.Interval,
+		RangeFrom:  opts.From,
+		RangeTo:    opts.To,
+		Params:     backtestParams(opts),
+		QueryRows:  len(patterns),
+	}
+	var predictions []db.EvaluationPrediction
+	for j := range results {
+		summary := Summarize(results[j].Predictions)
+		results[j].Summary = summary
+		predictions = append(predictions, results[j].Predictions...)
+
+		hitRate := summary.HitRate
+		if summary.Predictions == 0 {
+			hitRate = math.NaN()
+		}
+		run.Predictors = append(run.Predictors, db.EvaluationPredictorResult{
+			Predictor:   results[j].Predictor,
+			Predictions: summary.Predictions,
+			HitRate:     hitRate,
+			Coverage:    summary.Coverage,
+			Summary:     summary,
+		})
+	}
+	id, err := store.InsertEvaluationRun(run, predictions)
+	if err != nil {
+		return Backtest{}, fmt.Errorf("storing evaluation run: %w", err)
+	}
+
+	for _, r := range results {
+		log.Info(fmt.Sprintf("Walk-forward run %d, %s: hit rate %.2f%% over %d predictions, coverage %.2f%% of %d rows",
+			id, r.Predictor, r.Summary.HitRate*100, r.Summary.Predictions, r.Summary.Coverage*100, r.Summary.QueryRows))
+	}
+	return Backtest{RunID: id, Results: results}, nil
+}
+
+// Summarize scores the predictions of a run
+func Summarize(predictions []db.EvaluationPrediction) BacktestSummary {
+	s := BacktestSummary{QueryRows: len(predictions)}
+	buckets := map[int]*ConfidenceBucket{}
+	maxBucket := -1
+	neighbors := 0
+
+	for _, p := range predictions {
+		neighbors += p.Neighbors
+		up := p.Actual > 0
+		switch {
+		case p.Predicted > 0 && up:
+			s.Confusion.UpUp++
+		case p.Predicted > 0:
+			s.Confusion.UpDown++
+		case p.Predicted < 0 && up:
+			s.Confusion.DownUp++
+		case p.Predicted < 0:
+			s.Confusion.DownDown++
+		case up:
+			s.Confusion.NoneUp++
+		default:
+			s.Confusion.NoneDown++
+		}
+		if p.Predicted == 0 {
+			continue
+		}
+
+		s.Predictions++
+		hit := p.Predicted == p.Actual
+		if hit {
+			s.Correct++
+		}
+
+		// Predictors other than the majority vote may decide when the votes are even
+		index := (p.NumDiffCount + confidenceBucketWidth - 1) / confidenceBucketWidth
+		b, ok := buckets[index]
+		if !ok {
+			b = &ConfidenceBucket{Label: "0", index: index}
+			if index > 0 {
+				b.Label = fmt.Sprintf("%d-%d", (index-1)*confidenceBucketWidth+1, index*confidenceBucketWidth)
+			}
+			buckets[index] = b
+		}
+		b.Predictions++
+		if hit {
+			b.Correct++
+		}
+		maxBucket = max(maxBucket, index)
+	}
+
+	c := s.Confusion
+	s.HitRate = ratio(s.Correct, s.Predictions)
+	s.Coverage = ratio(s.Predictions, s.QueryRows)
+	s.MeanNeighbors = float64(neighbors) / math.Max(float64(s.QueryRows), 1)
+	s.Up = DirectionScore{
+		Predicted: c.UpUp + c.UpDown,
+		Actual:    c.UpUp + c.DownUp + c.NoneUp,
+		Precision: ratio(c.UpUp, c.UpUp+c.UpDown),
+		Recall:    ratio(c.UpUp, c.UpUp+c.DownUp+c.NoneUp),
+	}
+	s.Down = DirectionScore{
+		Predicted: c.DownUp + c.DownDown,
+		Actual:    c.UpDown + c.DownDown + c.NoneDown,
+		Precision: ratio(c.DownDown, c.DownUp+c.DownDown),
+		Recall:    ratio(c.DownDown, c.UpDown+c.DownDown+c.NoneDown),
+	}
+	for i := 0; i <= maxBucket; i++ {
+		if b, ok := buckets[i]; ok {
+			b.HitRate = ratio(b.Correct, b.Predictions)
+			s.Buckets = append(s.Buckets, *b)
+		}
+	}
+	return s
+}
+
+// WriteBacktestTable prints the predictors of a run side by side for a human at the terminal
+func WriteBacktestTable(w io.Writer, b Backtest) error {
+	if len(b.Results) == 0 {
+		return nil
+	}
+	t := newComparisonTable(fmt.Sprintf("Evaluation run %d, %d query rows", b.RunID, b.Results[0].Summary.QueryRows), b.Results,
+		func(r PredictorBacktest) string { return r.Predictor })
+
+	t.row("Predictions", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Predictions) })
+	t.row("Coverage", func(r PredictorBacktest) string { return percent(r.Summary.Coverage) })
+	t.row("Hit rate", func(r PredictorBacktest) string { return percent(r.Summary.HitRate) })
+	t.row("Up precision", func(r PredictorBacktest) string { return percent(r.Summary.Up.Precision) })
+	t.row("Up recall", func(r PredictorBacktest) string { return percent(r.Summary.Up.Recall) })
+	t.row("Down precision", func(r PredictorBacktest) string { return percent(r.Summary.Down.Precision) })
+	t.row("Down recall", func(r PredictorBacktest) string { return percent(r.Summary.Down.Recall) })
+	t.rule()
+
+	// Confusion matrix, predicted / actual
+	t.row("Up / up", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Confusion.UpUp) })
+	t.row("Up / down", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Confusion.UpDown) })
+	t.row("Down / up", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Confusion.DownUp) })
+	t.row("Down / down", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Confusion.DownDown) })
+	t.row("None / up", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Confusion.NoneUp) })
+	t.row("None / down", func(r PredictorBacktest) string { return fmt.Sprint(r.Summary.Confusion.NoneDown) })
+	t.rule()
+
+	// Hit rate by NumDiffCount, every bucket any predictor has
+	labels := map[int]string{}
+	for _, r := range b.Results {
+		for _, bucket := range r.Summary.Buckets {
+			labels[bucket.index] = bucket.Label
+		}
+	}
+	indexes := make([]int, 0, len(labels))
+	for index := range labels {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		t.row("NumDiff "+labels[index], func(r PredictorBacktest) string {
+			for _, bucket := range r.Summary.Buckets {
+				if bucket.index == index {
+					return fmt.Sprintf("%s (%d)", percent(bucket.HitRate), bucket.Predictions)
+				}
+			}
+			return "-"
+		})
+	}
+	return t.write(w)
+}
+
+// comparisonTable has a row per metric and a column per predictor
+type comparisonTable[T any] struct {
+	columns []T
+	lines   []string
+	width   int
+}
+
+const comparisonColumnWidth = 16
+
+func newComparisonTable[T any](title string, columns []T, name func(T) string) *comparisonTable[T] {
+	t := &comparisonTable[T]{columns: columns, width: 20 + len(columns)*(comparisonColumnWidth+3)}
+	t.rule()
+	t.lines = append(t.lines, title)
+	t.rule()
+	t.row("", name)
+	t.rule()
+	return t
+}
+
+func (t *comparisonTable[T]) row(label string, cell func(T) string) {
+	line := fmt.Sprintf("%-20s", label)
+	for _, c := range t.columns {
+		line += fmt.Sprintf(" | %*s", comparisonColumnWidth, cell(c))
+	}
+	t.lines = append(t.lines, line)
+}
+
+func (t *comparisonTable[T]) rule() {
+	t.lines = append(t.lines, strings.Repeat("-", t.width))
+}
+
+func (t *comparisonTable[T]) write(w io.Writer) error {
+	t.rule()
+	_, err := io.WriteString(w, strings.Join(t.lines, "\n")+"\n")
+	return err
+}
+
+func percent(v float64) string {
+	return fmt.Sprintf("%.2f%%", v*100)
+}
+
+func backtestParams(opts BacktestOptions) map[string]any {
+	// Predictors marshal to their knobs, e.g. {"Bandwidth": 0}
+	predictors := make(map[string]Predictor, len(opts.Predictors))
+	for _, p := range opts.Predictors {
+		predictors[p.Name()] = p
+	}
+	params := map[string]any{
+		"predictors":      predictors,
+		"target":          opts.Target,
+		"k":               opts.K,
+		"horizon":         opts.horizon(),
+		"embargo_seconds": opts.Embargo.Seconds(),
+	}
+	if len(opts.NeighborSymbols) > 0 {
+		params["neighbor_symbols"] = opts.NeighborSymbols
+	}
+	if len(opts.NeighborIntervals) > 0 {
+		params["neighbor_intervals"] = opts.NeighborIntervals
+	}
+	if !opts.TrainFrom.IsZero() {
+		params["train_from"] = opts.TrainFrom
+	}
+	if !opts.TrainTo.IsZero() {
+		params["train_to"] = opts.TrainTo
+	}
+	return params
+}
+
+func ratio(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
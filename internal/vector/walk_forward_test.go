@@ -0,0 +1,140 @@
+package vector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"vector-quant-monitor/internal/db"
+)
+
+// scored is a prediction from 5 neighbors with the given vote margin
+func scored(predicted int, actual int, numDiff int) db.EvaluationPrediction {
+	return db.EvaluationPrediction{Predicted: predicted, Actual: actual, NumDiffCount: numDiff, Neighbors: 5}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name        string
+		predictions []db.EvaluationPrediction
+		want        BacktestSummary
+	}{
+		{name: "no rows", want: BacktestSummary{}},
+		{
+			name: "ties lower coverage and recall but not the hit rate",
+			predictions: []db.EvaluationPrediction{
+				scored(1, 1, 3),
+				scored(1, -1, 2),
+				scored(-1, -1, 5),
+				scored(0, 1, 0),
+				scored(0, -1, 0),
+			},
+			want: BacktestSummary{
+				QueryRows:     5,
+				Predictions:   3,
+				Correct:       2,
+				HitRate:       2.0 / 3,
+				Coverage:      3.0 / 5,
+				MeanNeighbors: 5,
+				Up:            DirectionScore{Predicted: 2, Actual: 2, Precision: 0.5, Recall: 0.5},
+				Down:          DirectionScore{Predicted: 1, Actual: 3, Precision: 1, Recall: 1.0 / 3},
+				Confusion:     ConfusionMatrix{UpUp: 1, UpDown: 1, DownDown: 1, NoneUp: 1, NoneDown: 1},
+				Buckets: []ConfidenceBucket{
+					{Label: "1-4", Predictions: 2, Correct: 1, HitRate: 0.5, index: 1},
+					{Label: "5-8", Predictions: 1, Correct: 1, HitRate: 1, index: 2},
+				},
+			},
+		},
+		{
+			name: "all abstain",
+			predictions: []db.EvaluationPrediction{
+				scored(0, 1, 0),
+				scored(0, 1, 0),
+				scored(0, -1, 0),
+			},
+			want: BacktestSummary{
+				QueryRows:     3,
+				MeanNeighbors: 5,
+				Up:            DirectionScore{Actual: 2},
+				Down:          DirectionScore{Actual: 1},
+				Confusion:     ConfusionMatrix{NoneUp: 2, NoneDown: 1},
+			},
+		},
+		{
+			name: "accuracy per NumDiffCount bucket",
+			predictions: []db.EvaluationPrediction{
+				// Even votes, decided by the distances
+				scored(1, -1, 0),
+				scored(-1, -1, 1),
+				scored(-1, -1, 4),
+				scored(1, -1, 4),
+				// Nothing in 5-8
+				scored(1, 1, 9),
+				scored(1, 1, 12),
+				scored(-1, 1, 13),
+			},
+			want: BacktestSummary{
+				QueryRows:     7,
+				Predictions:   7,
+				Correct:       4,
+				HitRate:       4.0 / 7,
+				Coverage:      1,
+				MeanNeighbors: 5,
+				Up:            DirectionScore{Predicted: 4, Actual: 3, Precision: 0.5, Recall: 2.0 / 3},
+				Down:          DirectionScore{Predicted: 3, Actual: 4, Precision: 2.0 / 3, Recall: 0.5},
+				Confusion:     ConfusionMatrix{UpUp: 2, UpDown: 2, DownUp: 1, DownDown: 2},
+				Buckets: []ConfidenceBucket{
+					{Label: "0", Predictions: 1, Correct: 0, HitRate: 0, index: 0},
+					{Label: "1-4", Predictions: 3, Correct: 2, HitRate: 2.0 / 3, index: 1},
+					{Label: "9-12", Predictions: 2, Correct: 2, HitRate: 1, index: 3},
+					{Label: "13-16", Predictions: 1, Correct: 0, HitRate: 0, index: 4},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.predictions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteBacktestTable(t *testing.T) {
+	backtest := Backtest{RunID: 7, Results: []PredictorBacktest{
+		{Predictor: "majority", Summary: Summarize([]db.EvaluationPrediction{scored(1, 1, 3), scored(0, -1, 0)})},
+		{Predictor: "kernel", Summary: Summarize([]db.EvaluationPrediction{scored(1, 1, 3), scored(-1, -1, 9)})},
+	}}
+	var out strings.Builder
+	if err := WriteBacktestTable(&out, backtest); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		cells := strings.Split(line, "|")
+		if len(cells) != 3 {
+			continue
+		}
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		rows[cells[0]] = cells[1:]
+	}
+	for label, want := range map[string][]string{
+		"":             {"majority", "kernel"},
+		"Coverage":     {"50.00%", "100.00%"},
+		"Hit rate":     {"100.00%", "100.00%"},
+		"None / down":  {"1", "0"},
+		"NumDiff 1-4":  {"100.00% (1)", "100.00% (1)"},
+		"NumDiff 9-12": {"-", "100.00% (1)"},
+	} {
+		if !reflect.DeepEqual(rows[label], want) {
+			t.Errorf("row %q: got %q, want %q", label, rows[label], want)
+		}
+	}
+	if !strings.Contains(out.String(), "Evaluation run 7, 2 query rows") {
+		t.Errorf("title missing in\n%s", out.String())
+	}
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff returns an exponential delay for the given attempt (starting at 0)
+// capped at max, with jitter in [d/2, d] so reconnecting clients spread out.
+func Backoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half+1)
+}
@@ -1,19 +1,224 @@
 package util
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 )
 
+const serviceName = "vector-quant-monitor"
+
+// Levels of the process. Components without an override follow base, so
+// changing base at runtime moves all of them.
+var levels = struct {
+	mu         sync.RWMutex
+	base       slog.LevelVar
+	configured slog.Level // base before any runtime change, SIGUSR1 toggles back to it
+	overrides  map[string]*slog.LevelVar
+	output     slog.Handler
+}{
+	overrides: map[string]*slog.LevelVar{},
+}
+
+// NewLogger builds the process logger and makes it the slog default.
+//
+//   - LOG_LEVEL overrides level (debug, info, warn, error), info when both are empty
+//   - LOG_FORMAT is json (default) or text
+//   - LOG_LEVELS sets per-component levels, e.g. "backfill=debug,userstream=warn"
+//
+// Every record carries service, component (the logger group) and host.
 func NewLogger(level string, logger_group string) *slog.Logger {
-	handler := slog.NewJSONHandler(
-		os.Stdout,
-		&slog.HandlerOptions{
-			Level: slog.LevelInfo,
-		},
-	)
-	logger := slog.New(handler)
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		level = env
+	}
+	base, err := ParseLevel(level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, using info\n", err)
+		base = slog.LevelInfo
+	}
+
+	// The output handler lets everything through, levelHandler decides per component
+	opts := &slog.HandlerOptions{Level: slog.Level(-8)}
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	hostname, _ := os.Hostname()
+	handler = handler.WithAttrs([]slog.Attr{
+		slog.String("service", serviceName),
+		slog.String("host", hostname),
+	})
+
+	levels.mu.Lock()
+	levels.base.Set(base)
+	levels.configured = base
+	levels.output = handler
+	levels.overrides = map[string]*slog.LevelVar{}
+	for _, item := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		l, err := ParseLevel(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LOG_LEVELS %s: %v\n", name, err)
+			continue
+		}
+		v := new(slog.LevelVar)
+		v.Set(l)
+		levels.overrides[name] = v
+	}
+	levels.mu.Unlock()
+
+	logger := ComponentLogger(logger_group)
 	slog.SetDefault(logger)
 	return logger
+}
+
+// ComponentLogger returns a logger tagged with component whose level follows
+// the component's override, or the base level without one
+func ComponentLogger(component string) *slog.Logger {
+	levels.mu.RLock()
+	output := levels.output
+	levels.mu.RUnlock()
+	if output == nil {
+		output = slog.NewJSONHandler(os.Stdout, nil)
+	}
+	return slog.New(&levelHandler{
+		inner:     output.WithAttrs([]slog.Attr{slog.String("component", component)}),
+		component: component,
+	})
+}
+
+// ParseLevel accepts the slog names in any case plus "warning"
+func ParseLevel(s string) (slog.Level, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "warning") {
+		return slog.LevelWarn, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q", s)
+	}
+	return l, nil
+}
+
+// SetLevel changes the level at runtime, an empty component changes the base level
+func SetLevel(component string, level slog.Level) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	if component == "" {
+		levels.base.Set(level)
+		return
+	}
+	v, ok := levels.overrides[component]
+	if !ok {
+		v = new(slog.LevelVar)
+		levels.overrides[component] = v
+	}
+	v.Set(level)
+}
+
+// Levels reports the base level under "default" and every override
+func Levels() map[string]string {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	out := map[string]string{"default": levels.base.Level().String()}
+	for name, v := range levels.overrides {
+		out[name] = v.Level().String()
+	}
+	return out
+}
+
+func componentLevel(component string) slog.Level {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	if v, ok := levels.overrides[component]; ok {
+		return v.Level()
+	}
+	return levels.base.Level()
+}
+
+// WatchLevelSignal toggles the base level between debug and the configured level on SIGUSR1
+func WatchLevelSignal(ctx context.Context, log *slog.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				levels.mu.RLock()
+				next := levels.configured
+				if levels.base.Level() != slog.LevelDebug {
+					next = slog.LevelDebug
+				}
+				levels.mu.RUnlock()
+				SetLevel("", next)
+				log.Info(fmt.Sprintf("Log level set to %s by SIGUSR1", next))
+			}
+		}
+	}()
+}
+
+// LevelHandler serves the levels as JSON on GET. With allowChanges PUT/POST
+// change one, otherwise they are forbidden:
+//
+//	curl -X PUT 'localhost:9100/loglevel?level=debug&component=backfill'
+func LevelHandler(allowChanges bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			if !allowChanges {
+				http.Error(w, "changing log levels over HTTP is disabled", http.StatusForbidden)
+				return
+			}
+			level, err := ParseLevel(r.URL.Query().Get("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			SetLevel(r.URL.Query().Get("component"), level)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Levels())
+	})
+}
+
+// levelHandler filters records by the current level of its component
+type levelHandler struct {
+	inner     slog.Handler
+	component string
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= componentLevel(h.component)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), component: h.component}
+}
 
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), component: h.component}
 }
@@ -0,0 +1,178 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// captureLogs sends the records of every component logger to a buffer and
+// restores the process levels after the test
+func captureLogs(t *testing.T, base slog.Level) *bytes.Buffer {
+	var out bytes.Buffer
+	defaultLogger := slog.Default()
+	levels.mu.Lock()
+	levels.base.Set(base)
+	levels.configured = base
+	levels.overrides = map[string]*slog.LevelVar{}
+	levels.output = slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.Level(-8)})
+	levels.mu.Unlock()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		levels.mu.Lock()
+		levels.base.Set(slog.LevelInfo)
+		levels.overrides = map[string]*slog.LevelVar{}
+		levels.output = nil
+		levels.mu.Unlock()
+	})
+	return &out
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{" warn ", slog.LevelWarn, false},
+		{"Warning", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"debug+2", slog.LevelDebug + 2, false},
+		{"", slog.LevelInfo, true},
+		{"verbose", slog.LevelInfo, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: got %s, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestNewLoggerLevels(t *testing.T) {
+	captureLogs(t, slog.LevelInfo)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("LOG_LEVELS", "backfill=debug, userstream = error,broken,host=loud,=info")
+	NewLogger("info", "run")
+
+	want := map[string]string{"default": "WARN", "backfill": "DEBUG", "userstream": "ERROR"}
+	got := Levels()
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, level := range want {
+		if got[name] != level {
+			t.Errorf("%q: got %s, want %s", name, got[name], level)
+		}
+	}
+
+	// An unknown LOG_LEVEL falls back to info
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("LOG_LEVELS", "")
+	NewLogger("debug", "run")
+	if got := Levels(); got["default"] != "INFO" || len(got) != 1 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	out := captureLogs(t, slog.LevelInfo)
+	backfill := ComponentLogger("backfill")
+	host := ComponentLogger("host").With("resource", "bot-1")
+
+	backfill.Debug("hidden")
+	SetLevel("backfill", slog.LevelDebug)
+	backfill.Debug("symbol rebuilt")
+	host.Debug("hidden")
+	host.Info("sample")
+	SetLevel("", slog.LevelError)
+	host.Warn("hidden")
+	backfill.Debug("still debug")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	want := []string{
+		"level=DEBUG msg=\"symbol rebuilt\" component=backfill",
+		"level=INFO msg=sample component=host resource=bot-1",
+		"level=DEBUG msg=\"still debug\" component=backfill",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d records:\n%s", len(lines), out)
+	}
+	for i, w := range want {
+		if !bytes.Contains(lines[i], []byte(w)) {
+			t.Errorf("record %d: got %s, want %s", i, lines[i], w)
+		}
+	}
+}
+
+func TestWatchLevelSignal(t *testing.T) {
+	captureLogs(t, slog.LevelWarn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	WatchLevelSignal(ctx, ComponentLogger("run"))
+
+	for _, want := range []string{"DEBUG", "WARN", "DEBUG"} {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for Levels()["default"] != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("level %s, want %s after SIGUSR1", Levels()["default"], want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowChanges bool
+		method       string
+		query        string
+		code         int
+		want         map[string]string
+	}{
+		{"list", false, http.MethodGet, "", http.StatusOK, map[string]string{"default": "INFO"}},
+		{"changes disabled", false, http.MethodPut, "?level=debug", http.StatusForbidden, map[string]string{"default": "INFO"}},
+		{"default level", true, http.MethodPut, "?level=debug", http.StatusOK, map[string]string{"default": "DEBUG"}},
+		{"component level", true, http.MethodPost, "?component=backfill&level=warn", http.StatusOK, map[string]string{"default": "INFO", "backfill": "WARN"}},
+		{"invalid level", true, http.MethodPut, "?level=loud", http.StatusBadRequest, map[string]string{"default": "INFO"}},
+		{"method", true, http.MethodDelete, "", http.StatusMethodNotAllowed, map[string]string{"default": "INFO"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLogs(t, slog.LevelInfo)
+			rec := httptest.NewRecorder()
+			LevelHandler(tt.allowChanges).ServeHTTP(rec, httptest.NewRequest(tt.method, "/loglevel"+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Errorf("got %d, want %d", rec.Code, tt.code)
+			}
+			if rec.Code == http.StatusOK {
+				var body map[string]string
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				if len(body) != len(tt.want) {
+					t.Errorf("body %v, want %v", body, tt.want)
+				}
+			}
+			got := Levels()
+			for name, level := range tt.want {
+				if got[name] != level {
+					t.Errorf("%s: level %s, want %s", name, got[name], level)
+				}
+			}
+		})
+	}
+}